@@ -1,10 +1,21 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"os"
+	"os/signal"
+	"path/filepath"
 	"runtime"
+	"strings"
+	"syscall"
+	"time"
 
+	"github.com/feliixx/gotranseq/ncbicode"
 	"github.com/feliixx/gotranseq/transeq"
 	"github.com/jessevdk/go-flags"
 )
@@ -12,39 +23,417 @@ import (
 const (
 	version  = "0.1"
 	toolName = "gotranseq"
+	// time between two updates of the progress
+	progressInterval = time.Second
+	// max nb of threads per CPU
+	maxThreadsPerCPU = 4
+	// size of the buffer when writing to a pipe, so
+	// the reader doesn't wait for the translations
+	pipeFlushBytes = 64 * 1024
+	// output filename to write to stdout
+	stdoutName = "-"
+	// exit code when the inputs have no sequence
+	noSequenceExitCode = 2
+	// exit code when the translation is stopped by SIGINT or
+	// SIGTERM, like shells do for an interrupted command
+	interruptedExitCode = 130
 )
 
+// returned by run when the inputs have no sequence, so scripts can
+// tell an empty input from an invalid one
+var errNoSequence = errors.New("no sequence in the input files")
+
+// returns errNoSequence if no sequence was read
+func checkSequences(summary transeq.Summary) error {
+	if summary.Sequences == 0 {
+		return errNoSequence
+	}
+	return nil
+}
+
 func printErrorAndExit(err error) {
-	fmt.Printf("error: %v\n", err)
+	fmt.Fprintf(os.Stderr, "error: %v\n", err)
 	os.Exit(1)
 }
 
 func run(options transeq.Options) error {
 
-	if options.Sequence == "" {
+	if len(options.Sequence) == 0 {
 		return fmt.Errorf("missing required parameter -s | -sequence, try %s --help for details", toolName)
 	}
-	if options.Outseq == "" {
+	if options.Outseq == "" && !options.Validate {
 		return fmt.Errorf("missing required parameter -o | -outseq, try %s --help for details", toolName)
 	}
 
+	var warnings io.Writer = os.Stderr
+	if options.Quiet {
+		warnings = ioutil.Discard
+		options.Warnings = warnings
+		options.Verbose = false
+		options.ShowProgress = false
+	}
+
 	if options.NumWorker == 0 {
-		options.NumWorker = runtime.NumCPU()
+		numWorker, err := transeq.DefaultNumWorker()
+		if err != nil {
+			return err
+		}
+		options.NumWorker = numWorker
+	}
+	// more threads don't make the translation faster
+	if maxThreads := maxThreadsPerCPU * runtime.NumCPU(); options.NumWorker > maxThreads {
+		fmt.Fprintf(warnings, "WARNING: %d threads for %d CPU, using %d threads\n", options.NumWorker, runtime.NumCPU(), maxThreads)
+		options.NumWorker = maxThreads
+	}
+
+	// each -s | --sequence value may be a comma-separated list of files
+	var inputFiles []string
+	for _, sequence := range options.Sequence {
+		inputFiles = append(inputFiles, strings.Split(sequence, ",")...)
+	}
+	// make sure all input files exist before creating the output file
+	var totalSize int64
+	unknownSize := false
+	for _, inputFile := range inputFiles {
+		if inputFile == transeq.StdinName || transeq.IsURL(inputFile) {
+			unknownSize = true
+			continue
+		}
+		info, err := os.Stat(inputFile)
+		if err != nil {
+			return err
+		}
+		totalSize += info.Size()
+	}
+	// the size of stdin or of a download is unknown, so is the total size
+	if unknownSize {
+		totalSize = 0
+	}
+
+	if options.Validate {
+		summary, err := transeq.ValidateFiles(inputFiles, options)
+		if err != nil {
+			return err
+		}
+		printSummary(summary, options)
+		return checkSequences(summary)
+	}
+
+	// make sure the output directories exist and that no input
+	// would be overwritten before reading the inputs
+	for _, name := range []string{options.Outseq, options.StatsFile, options.CodonUsageFile, options.BEDFile, options.GFFFile, options.CompositionFile} {
+		if name == "" || name == stdoutName {
+			continue
+		}
+		if err := checkOutputDir(name, options.Mkdir); err != nil {
+			return err
+		}
+		if err := checkNotInput(name, inputFiles); err != nil {
+			return err
+		}
+	}
+
+	if options.ShowProgress {
+		options.Progress = &transeq.Progress{}
+		stop := printProgress(options.Progress, totalSize)
+		defer stop()
+	}
+
+	if options.StatsFile != "" {
+		f, err := createOutput(options.StatsFile, false)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		options.Stats = f
+	}
+	if options.CodonUsageFile != "" {
+		f, err := createOutput(options.CodonUsageFile, false)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		options.CodonUsage = f
+	}
+	if options.BEDFile != "" {
+		f, err := createOutput(options.BEDFile, false)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		options.BED = f
+	}
+	if options.GFFFile != "" {
+		f, err := createOutput(options.GFFFile, false)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		options.GFF = f
+	}
+	if options.CompositionFile != "" {
+		f, err := createOutput(options.CompositionFile, false)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		options.Composition = f
+	}
+
+	if options.Split && options.SplitStrand {
+		return fmt.Errorf("--split and --split-strand can't be used together")
+	}
+	if options.Split || options.SplitStrand {
+		if options.Outseq == stdoutName {
+			return fmt.Errorf("--split and --split-strand can't be used when writing to stdout")
+		}
+		return translateSplit(inputFiles, options)
+	}
+
+	out := os.Stdout
+	if options.Outseq != stdoutName {
+		f, err := createOutput(options.Outseq, options.Append)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		out = f
+	}
+	if options.FlushBytes == 0 {
+		switch {
+		case options.Outseq == stdoutName && isTerminal(os.Stdout):
+			// don't make the user wait for the translations
+			options.FlushBytes = 1
+		case isPipe(out):
+			options.FlushBytes = pipeFlushBytes
+		}
+	}
+
+	summary, err := transeq.TranslateFiles(inputFiles, out, options)
+	if err != nil {
+		return err
+	}
+	printSummary(summary, options)
+	return checkSequences(summary)
+}
+
+// create or truncate an output file, or append to it if appendTo is set.
+// The file is opened write only, so a named pipe is opened like a regular
+// file: opening it waits for a reader, and it's not truncated
+func createOutput(name string, appendTo bool) (*os.File, error) {
+
+	flag := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	if appendTo {
+		flag = os.O_WRONLY | os.O_CREATE | os.O_APPEND
+	}
+	return os.OpenFile(name, flag, 0666)
+}
+
+// returns an error if the output file is one of the input files, even
+// through another path or a link, as it would be truncated before
+// being read
+func checkNotInput(name string, inputFiles []string) error {
+
+	outInfo, err := os.Stat(name)
+	if err != nil {
+		// the output doesn't exist yet
+		return nil
+	}
+	for _, inputFile := range inputFiles {
+		if inputFile == transeq.StdinName || transeq.IsURL(inputFile) {
+			continue
+		}
+		if inInfo, err := os.Stat(inputFile); err == nil && os.SameFile(inInfo, outInfo) {
+			return fmt.Errorf("output file %s is also the input file %s", name, inputFile)
+		}
+	}
+	return nil
+}
+
+// returns an error if the directory of the output file doesn't
+// exist, or creates it if mkdir is set
+func checkOutputDir(name string, mkdir bool) error {
+
+	dir := filepath.Dir(name)
+	info, err := os.Stat(dir)
+	switch {
+	case os.IsNotExist(err) && mkdir:
+		return os.MkdirAll(dir, 0777)
+	case os.IsNotExist(err):
+		return fmt.Errorf("output directory %s doesn't exist, use --mkdir to create it", dir)
+	case err != nil:
+		return err
+	case !info.IsDir():
+		return fmt.Errorf("can't write to %s: %s is not a directory", name, dir)
+	}
+	return nil
+}
+
+// returns true if f is a terminal
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// returns true if f is a pipe or a named pipe
+func isPipe(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeNamedPipe != 0
+}
+
+func printSummary(summary transeq.Summary, options transeq.Options) {
+	if options.Verbose {
+		fmt.Fprintf(os.Stderr, "sequences read: %d\nframes written: %d\namino acids written: %d\ndistinct amino acids: %s\nelapsed time: %v\n",
+			summary.Sequences, summary.Frames, summary.AminoAcids, summary.Alphabet, summary.Elapsed)
+		fmt.Fprintf(os.Stderr, "codons translated to X: %d\n  with a N: %d\n  with an ambiguity code: %d\n  incomplete terminal codon: %d\n",
+			summary.UnknownCodons+summary.AmbiguousCodons+summary.IncompleteCodons, summary.UnknownCodons, summary.AmbiguousCodons, summary.IncompleteCodons)
+		if options.Dedup {
+			fmt.Fprintf(os.Stderr, "duplicate proteins skipped: %d\n", summary.Duplicates)
+		}
+		if !options.Validate {
+			fmt.Fprintf(os.Stderr, "nucleotides translated: %d (%.2f MB/s)\n", summary.Nucleotides, throughput(summary))
+		}
 	}
+}
+
+// write the codons of a table translated to another AA than in the
+// standard code, with their AA in both codes, separated by tabs
+func dumpTable(out io.Writer, code int) error {
 
-	in, err := os.Open(options.Sequence)
+	changes, err := ncbicode.TableDiff(code)
 	if err != nil {
 		return err
 	}
-	defer in.Close()
+	var buf bytes.Buffer
+	buf.WriteString("codon\tstandard\taa\n")
+	for _, c := range changes {
+		fmt.Fprintf(&buf, "%s\t%c\t%c\n", c.Codon, c.Standard, c.AA)
+	}
+	_, err = out.Write(buf.Bytes())
+	return err
+}
+
+// returns the nb of MB of nucleotides translated per second
+func throughput(summary transeq.Summary) float64 {
+
+	seconds := summary.Elapsed.Seconds()
+	if seconds == 0 {
+		return 0
+	}
+	return float64(summary.Nucleotides) / (1024 * 1024) / seconds
+}
 
-	out, err := os.Create(options.Outseq)
+// print the progress of the translation to stderr every progressInterval,
+// on a single line. Returns a func to call once the translation is done
+func printProgress(progress *transeq.Progress, totalSize int64) (stop func()) {
+
+	update := func() {
+		fmt.Fprintf(os.Stderr, "\rsequences read: %d, %d MB read", progress.Sequences(), progress.BytesRead()/(1024*1024))
+		if totalSize > 0 {
+			fmt.Fprintf(os.Stderr, " (%d%%)", 100*progress.BytesRead()/totalSize)
+		}
+	}
+
+	ticker := time.NewTicker(progressInterval)
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		for {
+			select {
+			case <-ticker.C:
+				update()
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return func() {
+		ticker.Stop()
+		close(done)
+		<-stopped
+		update()
+		fmt.Fprintln(os.Stderr)
+	}
+}
+
+// create one output file per requested frame, named like <outseq>_<frame>.<ext>,
+// or with --split-strand one file for the forward frames and one for the
+// reverse frames, named like <outseq>_forward.<ext> and <outseq>_reverse.<ext>
+func translateSplit(inputFiles []string, options transeq.Options) error {
+
+	frames, err := transeq.RequestedFrames(options.Frame)
 	if err != nil {
 		return err
 	}
-	defer out.Close()
 
-	return transeq.Translate(in, out, options)
+	ext := filepath.Ext(options.Outseq)
+	prefix := strings.TrimSuffix(options.Outseq, ext)
+
+	outs := make([]io.Writer, 6)
+	// frames of the same strand share their file
+	files := map[string]io.Writer{}
+	for _, frame := range frames {
+		name := fmt.Sprintf("%s_%d%s", prefix, frame, ext)
+		if options.SplitStrand {
+			strand := "forward"
+			if frame > 3 {
+				strand = "reverse"
+			}
+			name = fmt.Sprintf("%s_%s%s", prefix, strand, ext)
+		}
+		if out, ok := files[name]; ok {
+			outs[frame-1] = out
+			continue
+		}
+		if err := checkNotInput(name, inputFiles); err != nil {
+			return err
+		}
+		out, err := createOutput(name, options.Append)
+		if err != nil {
+			return err
+		}
+		defer out.Close()
+		outs[frame-1] = out
+		files[name] = out
+		if options.FlushBytes == 0 && isPipe(out) {
+			options.FlushBytes = pipeFlushBytes
+		}
+	}
+
+	summary, err := transeq.TranslateFilesSplit(inputFiles, outs, options)
+	if err != nil {
+		return err
+	}
+	printSummary(summary, options)
+	return checkSequences(summary)
+}
+
+// returns a context cancelled on SIGINT or SIGTERM, so the translation
+// stops and the sequences already translated are written before the
+// output files are closed. A second signal kills the program as usual
+func interruptContext() (context.Context, func()) {
+
+	ctx, cancel := context.WithCancel(context.Background())
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-signals:
+			signal.Stop(signals)
+			cancel()
+		case <-done:
+		}
+	}()
+
+	return ctx, func() {
+		signal.Stop(signals)
+		close(done)
+		cancel()
+	}
 }
 
 func main() {
@@ -53,7 +442,7 @@ func main() {
 	p := flags.NewParser(&options, flags.Default&^flags.HelpFlag)
 	_, err := p.Parse()
 	if err != nil {
-		fmt.Printf("wrong arguments: %v, try %s --help for more informations\n", err, toolName)
+		fmt.Fprintf(os.Stderr, "wrong arguments: %v, try %s --help for more informations\n", err, toolName)
 		os.Exit(1)
 	}
 	if options.Help {
@@ -65,9 +454,39 @@ func main() {
 		fmt.Printf("%s version version %s\n", toolName, version)
 		os.Exit(0)
 	}
+	if options.ListTables {
+		names := ncbicode.TableNames()
+		aliases := ncbicode.TableAliases()
+		for _, code := range ncbicode.TableCodes() {
+			fmt.Printf("%d: %s (%s)\n", code, names[code], strings.Join(aliases[code], ", "))
+		}
+		os.Exit(0)
+	}
+	// table 0 is a valid code, so check if the flag is set
+	if p.FindOptionByLongName("dump-table").IsSet() {
+		if err := dumpTable(os.Stdout, options.DumpTable); err != nil {
+			printErrorAndExit(err)
+		}
+		os.Exit(0)
+	}
 
+	ctx, stop := interruptContext()
+	options.Context = ctx
 	err = run(options)
+	stop()
+	if err == transeq.ErrInterrupted {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(interruptedExitCode)
+	}
+	if err == errNoSequence {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(noSequenceExitCode)
+	}
 	if err != nil {
-		fmt.Printf("fail to translate file:\n%v", err)
+		if options.Validate {
+			printErrorAndExit(err)
+		}
+		fmt.Fprintf(os.Stderr, "fail to translate file:\n%v\n", err)
+		os.Exit(1)
 	}
 }
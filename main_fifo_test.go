@@ -0,0 +1,70 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+func TestFifoOutput(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "gotranseq")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	fifo := filepath.Join(dir, "out.fifo")
+	if err := syscall.Mkfifo(fifo, 0600); err != nil {
+		t.Skipf("named pipes not supported: %v", err)
+	}
+
+	type result struct {
+		content []byte
+		err     error
+	}
+	read := make(chan result, 1)
+	go func() {
+		// blocks until gotranseq opens the pipe
+		f, err := os.Open(fifo)
+		if err != nil {
+			read <- result{err: err}
+			return
+		}
+		defer f.Close()
+		content, err := ioutil.ReadAll(f)
+		read <- result{content: content, err: err}
+	}()
+
+	_, stderr, exitCode := runMain(t, "", "-s", "transeq/testdata/test.fna", "-o", fifo, "-f", "6", "-n", "1")
+	if exitCode != 0 || stderr != "" {
+		t.Errorf("expected exit code 0 and no error, got %d: %s", exitCode, stderr)
+	}
+
+	var got result
+	select {
+	case got = <-read:
+	default:
+		// gotranseq didn't open the pipe, unblock the reader
+		if w, err := os.OpenFile(fifo, os.O_WRONLY|syscall.O_NONBLOCK, 0); err == nil {
+			w.Close()
+		}
+		got = <-read
+	}
+	if got.err != nil {
+		t.Fatal(got.err)
+	}
+
+	want, err := ioutil.ReadFile("transeq/testdata/golden/frame6.faa")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got.content) != string(want) {
+		t.Errorf("expected\n%s\nbut got\n%s\n", want, got.content)
+	}
+}
@@ -0,0 +1,480 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// when set, the test binary runs main() with the args in this
+// variable, separated by '\n'
+const mainArgsEnv = "GOTRANSEQ_MAIN_ARGS"
+
+func TestMain(m *testing.M) {
+	if args, ok := os.LookupEnv(mainArgsEnv); ok {
+		os.Args = append([]string{toolName}, strings.Split(args, "\n")...)
+		main()
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// run gotranseq with args and stdin, and returns its stdout, stderr and exit code
+func runMain(t *testing.T, stdin string, args ...string) (stdout, stderr string, exitCode int) {
+
+	cmd := exec.Command(os.Args[0])
+	cmd.Env = append(os.Environ(), mainArgsEnv+"="+strings.Join(args, "\n"))
+	cmd.Stdin = strings.NewReader(stdin)
+
+	var outBuf, errBuf bytes.Buffer
+	cmd.Stdout = &outBuf
+	cmd.Stderr = &errBuf
+
+	err := cmd.Run()
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		exitCode = exitErr.Sys().(interface{ ExitStatus() int }).ExitStatus()
+	} else if err != nil {
+		t.Fatal(err)
+	}
+	return outBuf.String(), errBuf.String(), exitCode
+}
+
+func TestValidate(t *testing.T) {
+
+	tests := []struct {
+		name     string
+		input    string
+		exitCode int
+		message  string
+	}{
+		{name: "valid file", input: "transeq/testdata/test.fna", exitCode: 0},
+		{name: "several valid files", input: "transeq/testdata/test.fna,transeq/testdata/test2.fna", exitCode: 0},
+		{name: "invalid char", input: "transeq/testdata/invalid_char.fna", exitCode: 1, message: "line 6: invalid char in sequence seq2: J"},
+		{name: "empty sequence", input: "transeq/testdata/empty_sequence.fna", exitCode: 1, message: "sequence a has no nucleotides"},
+		{name: "data before the first header", input: "transeq/testdata/data_before_header.fna", exitCode: 1, message: "line 1: sequence data before the first header"},
+		{name: "duplicate id", input: "transeq/testdata/test2.fna,transeq/testdata/test2.fna", exitCode: 1, message: "duplicate sequence id: other1"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, stderr, exitCode := runMain(t, "", "-s", test.input, "--validate")
+			if exitCode != test.exitCode {
+				t.Errorf("expected exit code %d but got %d, output: %s", test.exitCode, exitCode, stderr)
+			}
+			if !strings.Contains(stderr, test.message) {
+				t.Errorf("expected stderr to contain '%s' but got '%s'", test.message, stderr)
+			}
+		})
+	}
+}
+
+func TestDumpTable(t *testing.T) {
+
+	stdout, _, exitCode := runMain(t, "", "--dump-table", "2")
+	if exitCode != 0 {
+		t.Errorf("expected exit code 0 but got %d: %s", exitCode, stdout)
+	}
+	if want := "codon\tstandard\taa\nAGA\tR\t*\nAGG\tR\t*\nATA\tI\tM\nTGA\t*\tW\n"; stdout != want {
+		t.Errorf("expected\n%s\nbut got\n%s\n", want, stdout)
+	}
+
+	// the standard code has no difference
+	stdout, _, _ = runMain(t, "", "--dump-table", "0")
+	if want := "codon\tstandard\taa\n"; stdout != want {
+		t.Errorf("expected\n%s\nbut got\n%s\n", want, stdout)
+	}
+
+	_, stderr, exitCode := runMain(t, "", "--dump-table", "7")
+	if msg := "unsupported table code: 7"; exitCode != 1 || !strings.Contains(stderr, msg) {
+		t.Errorf("expected exit code 1 and stderr containing '%s' but got %d: '%s'", msg, exitCode, stderr)
+	}
+}
+
+func TestNoSequence(t *testing.T) {
+
+	for _, args := range [][]string{
+		{"-s", "-", "-o", "-"},
+		{"-s", "-", "--validate"},
+		{"-s", "-", "-o", "-", "--quiet"},
+	} {
+		stdout, stderr, exitCode := runMain(t, "", args...)
+		if exitCode != noSequenceExitCode {
+			t.Errorf("%v: expected exit code %d but got %d, output: %s", args, noSequenceExitCode, exitCode, stderr)
+		}
+		if msg := "no sequence in the input files"; !strings.Contains(stderr, msg) {
+			t.Errorf("%v: expected stderr to contain '%s' but got '%s'", args, msg, stderr)
+		}
+		if stdout != "" {
+			t.Errorf("%v: expected nothing on stdout but got '%s'", args, stdout)
+		}
+	}
+
+	// a parse error or any other failure has another exit code
+	for _, test := range []struct {
+		input string
+		args  []string
+	}{
+		{input: ">a\n>\nACGT\n", args: []string{"-s", "-", "--validate"}},
+		{input: ">a\n>\nACGT\n", args: []string{"-s", "-", "-o", "-"}},
+		{input: ">a\nACGT\n", args: []string{"-s", "-", "-o", "-", "-t", "7"}},
+	} {
+		args := test.args
+		stdout, stderr, exitCode := runMain(t, test.input, args...)
+		if exitCode != 1 {
+			t.Errorf("%v: expected exit code 1 for an invalid input but got %d", args, exitCode)
+		}
+		if output := stdout + stderr; !strings.HasSuffix(output, "\n") {
+			t.Errorf("%v: expected the error to end with a newline but got '%s'", args, output)
+		}
+	}
+}
+
+func TestStdinStdout(t *testing.T) {
+
+	input, err := ioutil.ReadFile("transeq/testdata/test2.fna")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := ">other1_1 from second file\nMA*\n>other2_1\nFP\n"
+
+	stdout, stderr, exitCode := runMain(t, string(input), "-s", "-", "-o", "-", "-f", "1")
+	if exitCode != 0 || stderr != "" {
+		t.Errorf("expected exit code 0 and no error, got %d: %s", exitCode, stderr)
+	}
+	if stdout != want {
+		t.Errorf("expected\n%s\nbut got\n%s\n", want, stdout)
+	}
+
+	// stdin with other files
+	stdout, _, _ = runMain(t, string(input), "-s", "transeq/testdata/test2.fna,-", "-o", "-", "-f", "1")
+	if stdout != want+want {
+		t.Errorf("expected\n%s\nbut got\n%s\n", want+want, stdout)
+	}
+}
+
+func TestGzippedStdin(t *testing.T) {
+
+	want, err := ioutil.ReadFile("transeq/testdata/golden/frame6.faa")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, input := range []string{"transeq/testdata/test.fna", "transeq/testdata/test.fna.gz", "transeq/testdata/test_multistream.fna.gz"} {
+		t.Run(input, func(t *testing.T) {
+			content, err := ioutil.ReadFile(input)
+			if err != nil {
+				t.Fatal(err)
+			}
+			stdout, stderr, exitCode := runMain(t, string(content), "-s", "-", "-o", "-", "-f", "6", "-n", "1")
+			if exitCode != 0 || stderr != "" {
+				t.Errorf("expected exit code 0 and no error, got %d: %s", exitCode, stderr)
+			}
+			if stdout != string(want) {
+				t.Errorf("expected\n%s\nbut got\n%s\n", want, stdout)
+			}
+		})
+	}
+}
+
+func TestInterrupt(t *testing.T) {
+
+	cmd := exec.Command(os.Args[0])
+	cmd.Env = append(os.Environ(), mainArgsEnv+"="+strings.Join([]string{"-s", "-", "-o", "-", "--flush-bytes", "1"}, "\n"))
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	// s1 is translated once the header of s2 is read
+	io.WriteString(stdin, ">s1\nATGGCC\n>s2\nTTT")
+	want := ">s1_1\nMA\n"
+	got := make([]byte, len(want))
+	if _, err := io.ReadFull(stdout, got); err != nil {
+		t.Fatal(err)
+	}
+	if err := cmd.Process.Signal(os.Interrupt); err != nil {
+		t.Fatal(err)
+	}
+	// let the signal stop the reading before the end of s2
+	time.Sleep(100 * time.Millisecond)
+	stdin.Close()
+
+	rest, err := ioutil.ReadAll(stdout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = cmd.Wait()
+	exitCode := 0
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		exitCode = exitErr.Sys().(interface{ ExitStatus() int }).ExitStatus()
+	}
+	if exitCode != interruptedExitCode {
+		t.Errorf("expected exit code %d but got %d", interruptedExitCode, exitCode)
+	}
+	// the output is still valid fasta, and the error is on stderr
+	if output := string(got) + string(rest); output != want {
+		t.Errorf("expected output\n%s\nbut got\n%s", want, output)
+	}
+	if msg := "error: translation interrupted\n"; stderr.String() != msg {
+		t.Errorf("expected stderr '%s' but got '%s'", msg, stderr.String())
+	}
+}
+
+func TestQuiet(t *testing.T) {
+
+	args := []string{"-s", "transeq/testdata/invalid_char.fna", "-o", "-", "-n", "100000", "--verbose", "--progress", "--warn-ambiguous"}
+
+	_, stderr, _ := runMain(t, "", args...)
+	if stderr == "" {
+		t.Error("expected warnings and a summary without --quiet")
+	}
+
+	stdout, stderr, exitCode := runMain(t, "", append(args, "--quiet")...)
+	if exitCode != 0 || stderr != "" {
+		t.Errorf("expected exit code 0 and no output on stderr, got %d: %s", exitCode, stderr)
+	}
+	if !strings.HasPrefix(stdout, ">seq1_1") {
+		t.Errorf("expected the translation on stdout, but got '%s'", stdout)
+	}
+
+	// errors are still printed
+	_, stderr, _ = runMain(t, "", "-s", "transeq/testdata/invalid_char.fna", "--validate", "--quiet")
+	if msg := "invalid char in sequence seq2"; !strings.Contains(stderr, msg) {
+		t.Errorf("expected stderr to contain '%s' but got '%s'", msg, stderr)
+	}
+}
+
+func TestAppend(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "gotranseq")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	out := filepath.Join(dir, "out.faa")
+
+	first := ">other1_1 from second file\nMA*\n>other2_1\nFP\n"
+	second := ">seq1_1 first sequence\nMPKGMP\n"
+
+	for _, args := range [][]string{
+		{"-s", "transeq/testdata/test2.fna", "-o", out, "--append"},
+		{"-s", "-", "-o", out, "--append", "--flush-bytes", "1"},
+	} {
+		if _, stderr, exitCode := runMain(t, ">seq1 first sequence\nATGCCCAAAGGGATGCCC\n", args...); exitCode != 0 || stderr != "" {
+			t.Errorf("expected exit code 0 and no error, got %d: %s", exitCode, stderr)
+		}
+	}
+	got, err := ioutil.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := first + second; string(got) != want {
+		t.Errorf("expected\n%s\nbut got\n%s\n", want, got)
+	}
+
+	// without --append, the file is overwritten
+	runMain(t, "", "-s", "transeq/testdata/test2.fna", "-o", out)
+	got, err = ioutil.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != first {
+		t.Errorf("expected\n%s\nbut got\n%s\n", first, got)
+	}
+
+	// the tsv header is only written to empty files
+	tsv := filepath.Join(dir, "out.tsv")
+	for _, args := range [][]string{
+		{"-s", "transeq/testdata/test2.fna", "-o", tsv, "--append", "--format", "tsv", "--tsv-header"},
+		{"-s", "transeq/testdata/test2.fna", "-o", tsv, "--append", "--format", "tsv", "--tsv-header", "--group-by-frame"},
+		{"-s", "transeq/testdata/test2.fna", "-o", tsv, "--append", "--format", "tsv", "--tsv-header", "--split"},
+		{"-s", "transeq/testdata/test2.fna", "-o", tsv, "--append", "--format", "tsv", "--tsv-header", "--split"},
+	} {
+		runMain(t, "", args...)
+	}
+	rows := "other1\t1\t3\tMA*\nother2\t1\t2\tFP\n"
+	for name, want := range map[string]string{
+		"out.tsv":   "id\tframe\tlength\tprotein\n" + rows + rows,
+		"out_1.tsv": "id\tframe\tlength\tprotein\n" + rows + rows,
+	} {
+		got, err := ioutil.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != want {
+			t.Errorf("%s: expected\n%s\nbut got\n%s\n", name, want, got)
+		}
+	}
+}
+
+func TestMissingOutputDir(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "gotranseq")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	missing := filepath.Join(dir, "missing", "proteins")
+	out := filepath.Join(missing, "out.faa")
+
+	_, stderr, _ := runMain(t, "", "-s", "transeq/testdata/test2.fna", "-o", out)
+	if msg := "output directory " + missing + " doesn't exist, use --mkdir to create it"; !strings.Contains(stderr, msg) {
+		t.Errorf("expected stderr to contain '%s' but got '%s'", msg, stderr)
+	}
+
+	// the stats file is also an output
+	_, stderr, _ = runMain(t, "", "-s", "transeq/testdata/test2.fna", "-o", "-", "--stats", filepath.Join(missing, "stats.tsv"))
+	if msg := "output directory " + missing + " doesn't exist"; !strings.Contains(stderr, msg) {
+		t.Errorf("expected stderr to contain '%s' but got '%s'", msg, stderr)
+	}
+
+	stdout, stderr, exitCode := runMain(t, "", "-s", "transeq/testdata/test2.fna", "-o", out, "--mkdir")
+	if exitCode != 0 || stdout != "" || stderr != "" {
+		t.Errorf("expected exit code 0 and no output, got %d: %s%s", exitCode, stdout, stderr)
+	}
+	got, err := ioutil.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := ">other1_1 from second file\nMA*\n>other2_1\nFP\n"; string(got) != want {
+		t.Errorf("expected\n%s\nbut got\n%s\n", want, got)
+	}
+}
+
+func TestOutputIsInput(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "gotranseq")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	content, err := ioutil.ReadFile("transeq/testdata/test2.fna")
+	if err != nil {
+		t.Fatal(err)
+	}
+	input := filepath.Join(dir, "seq.fna")
+	if err := ioutil.WriteFile(input, content, 0666); err != nil {
+		t.Fatal(err)
+	}
+	link := filepath.Join(dir, "link.fna")
+	if err := os.Symlink(input, link); err != nil {
+		t.Fatal(err)
+	}
+	// with --split, frame 1 is written to split_1.fna
+	if err := os.Symlink(input, filepath.Join(dir, "split_1.fna")); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, args := range [][]string{
+		{"-s", input, "-o", input},
+		{"-s", "transeq/testdata/test2.fna," + input, "-o", filepath.Join(dir, ".", "seq.fna")},
+		{"-s", link, "-o", input},
+		{"-s", input, "-o", "-", "--stats", link},
+		{"-s", input, "-o", filepath.Join(dir, "split.fna"), "--split", "--frame", "F"},
+	} {
+		_, stderr, _ := runMain(t, "", args...)
+		if msg := "is also the input file"; !strings.Contains(stderr, msg) {
+			t.Errorf("%v: expected stderr to contain '%s' but got '%s'", args, msg, stderr)
+		}
+	}
+	// the input is not modified
+	got, err := ioutil.ReadFile(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != string(content) {
+		t.Errorf("expected input to be unchanged but got\n%s", got)
+	}
+}
+
+func TestSplitStrand(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "gotranseq")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	runMain(t, "", "-s", "transeq/testdata/test2.fna", "-o", filepath.Join(dir, "out.fna"), "--split-strand", "--frame", "6")
+
+	for name, want := range map[string]string{
+		"out_forward.fna": ">other1_1 from second file\nMA*\n>other1_2 from second file\nWRX\n>other1_3 from second file\nGVX\n>other2_1\nFP\n>other2_2\nFP\n>other2_3\nSX\n",
+		"out_reverse.fna": ">other1_4 from second file\nLRH\n>other1_5 from second file\nTPX\n>other1_6 from second file\nYAX\n>other2_4\nGK\n>other2_5\nEX\n>other2_6\nGX\n",
+	} {
+		got, err := ioutil.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != want {
+			t.Errorf("%s: expected\n%s\nbut got\n%s", name, want, got)
+		}
+	}
+
+	// no file for the strand without requested frames
+	runMain(t, "", "-s", "transeq/testdata/test2.fna", "-o", filepath.Join(dir, "forward.fna"), "--split-strand", "--frame", "F")
+	if _, err := os.Stat(filepath.Join(dir, "forward_reverse.fna")); !os.IsNotExist(err) {
+		t.Errorf("expected no file for the reverse frames but got %v", err)
+	}
+
+	_, stderr, _ := runMain(t, "", "-s", "transeq/testdata/test2.fna", "-o", filepath.Join(dir, "out.fna"), "--split-strand", "--split")
+	if msg := "--split and --split-strand can't be used together"; !strings.Contains(stderr, msg) {
+		t.Errorf("expected stderr to contain '%s' but got '%s'", msg, stderr)
+	}
+}
+
+func TestNumWorker(t *testing.T) {
+
+	input, err := ioutil.ReadFile("transeq/testdata/test2.fna")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := ">other1_1 from second file\nMA*\n>other2_1\nFP\n"
+
+	// 0 is the nb of CPU
+	stdout, stderr, _ := runMain(t, string(input), "-s", "-", "-o", "-", "-n", "0")
+	if stdout != want || stderr != "" {
+		t.Errorf("expected\n%s\nbut got\n%s\n%s", want, stdout, stderr)
+	}
+
+	_, stderr, _ = runMain(t, string(input), "-s", "-", "-o", "-", "-n", "-1")
+	if msg := "wrong value for -n | --numcpu parameter: -1, must be at least 1"; !strings.Contains(stderr, msg) {
+		t.Errorf("expected stderr to contain '%s' but got '%s'", msg, stderr)
+	}
+
+	stdout, stderr, _ = runMain(t, string(input), "-s", "-", "-o", "-", "-n", "100000")
+	if stdout != want {
+		t.Errorf("expected\n%s\nbut got\n%s\n", want, stdout)
+	}
+	if !strings.Contains(stderr, "WARNING: 100000 threads") {
+		t.Errorf("expected a warning for too many threads but got '%s'", stderr)
+	}
+
+	// the flag takes precedence over the environment variable
+	os.Setenv("GOTRANSEQ_WORKERS", "none")
+	defer os.Unsetenv("GOTRANSEQ_WORKERS")
+	stdout, _, _ = runMain(t, string(input), "-s", "-", "-o", "-", "-n", "1")
+	if stdout != want {
+		t.Errorf("expected\n%s\nbut got\n%s\n", want, stdout)
+	}
+	_, stderr, _ = runMain(t, string(input), "-s", "-", "-o", "-")
+	if msg := "wrong value for GOTRANSEQ_WORKERS environment variable: none"; !strings.Contains(stderr, msg) {
+		t.Errorf("expected stderr to contain '%s' but got '%s'", msg, stderr)
+	}
+}
@@ -8,7 +8,12 @@
 package ncbicode
 
 import (
+	"bufio"
+	"bytes"
 	"fmt"
+	"io"
+	"sort"
+	"strconv"
 	"strings"
 )
 
@@ -313,8 +318,9 @@ var (
 	}
 
 	diffs = map[int]map[string]byte{
-		VertebrateMitochondrial: vertebrateMitochondrialDiff,
-		YeastMitochondrial:      yeastMitochondrialDiff,
+		StandardAlternativeInitiation: {},
+		VertebrateMitochondrial:       vertebrateMitochondrialDiff,
+		YeastMitochondrial:            yeastMitochondrialDiff,
 		MoldProtozoanCoelenterateMitochondrialMycoplasmaSpiroplasma: moldProtozoanCoelenterateMitochondrialMycoplasmaSpiroplasmaDiff,
 		InvertebrateMitochondrial:                                   invertebrateMitochondrialDiff,
 		CiliateDasycladaceanHexamita:                                ciliateDasycladaceanHexamitaDiff,
@@ -334,10 +340,100 @@ var (
 		Mesodinium:                                                  mesodiniumDiff,
 		Peritrich:                                                   peritrichDiff,
 	}
+
+	names = map[int]string{
+		Standard:                      "Standard Code",
+		StandardAlternativeInitiation: "Standard Code with alternative initiation codons",
+		VertebrateMitochondrial:       "The Vertebrate Mitochondrial Code",
+		YeastMitochondrial:            "The Yeast Mitochondrial Code",
+		MoldProtozoanCoelenterateMitochondrialMycoplasmaSpiroplasma: "The Mold, Protozoan, and Coelenterate Mitochondrial Code and the Mycoplasma/Spiroplasma Code",
+		InvertebrateMitochondrial:                                   "The Invertebrate Mitochondrial Code",
+		CiliateDasycladaceanHexamita:                                "The Ciliate, Dasycladacean and Hexamita Nuclear Code",
+		EchinodermFlatwormMitochondrial:                             "The Echinoderm and Flatworm Mitochondrial Code",
+		Euplotid:                                                    "The Euplotid Nuclear Code",
+		BacterialArchaealPlantPlastid:                               "The Bacterial, Archaeal and Plant Plastid Code",
+		AlternativeYeast:                                            "The Alternative Yeast Nuclear Code",
+		AscidianMitochondrial:                                       "The Ascidian Mitochondrial Code",
+		AlternativeFlatwormMitochondrial:                            "The Alternative Flatworm Mitochondrial Code",
+		ChlorophyceanMitochondrial:                                  "Chlorophycean Mitochondrial Code",
+		TrematodeMitochondrial:                                      "Trematode Mitochondrial Code",
+		ScenedesmusObliquusMitochondrial:                            "Scenedesmus obliquus Mitochondrial Code",
+		ThraustochytriumMitochondrial:                               "Thraustochytrium Mitochondrial Code",
+		PterobranchiaMitochondrial:                                  "Pterobranchia Mitochondrial Code",
+		CandidateDivisionSR1Gracilibacteria:                         "Candidate Division SR1 and Gracilibacteria Code",
+		PachysolenTannophilus:                                       "Pachysolen tannophilus Nuclear Code",
+		Mesodinium:                                                  "Mesodinium Nuclear Code",
+		Peritrich:                                                   "Peritrich Nuclear Code",
+	}
+
+	// short names of the tables, so they can be selected without their code.
+	// A table can have several names, like the organisms it applies to
+	aliases = map[string]int{
+		"standard":                           Standard,
+		"standard-alternative-initiation":    StandardAlternativeInitiation,
+		"vertebrate-mitochondrial":           VertebrateMitochondrial,
+		"yeast-mitochondrial":                YeastMitochondrial,
+		"mold-mitochondrial":                 MoldProtozoanCoelenterateMitochondrialMycoplasmaSpiroplasma,
+		"protozoan-mitochondrial":            MoldProtozoanCoelenterateMitochondrialMycoplasmaSpiroplasma,
+		"coelenterate-mitochondrial":         MoldProtozoanCoelenterateMitochondrialMycoplasmaSpiroplasma,
+		"mycoplasma":                         MoldProtozoanCoelenterateMitochondrialMycoplasmaSpiroplasma,
+		"spiroplasma":                        MoldProtozoanCoelenterateMitochondrialMycoplasmaSpiroplasma,
+		"invertebrate-mitochondrial":         InvertebrateMitochondrial,
+		"ciliate-nuclear":                    CiliateDasycladaceanHexamita,
+		"dasycladacean-nuclear":              CiliateDasycladaceanHexamita,
+		"hexamita-nuclear":                   CiliateDasycladaceanHexamita,
+		"echinoderm-mitochondrial":           EchinodermFlatwormMitochondrial,
+		"flatworm-mitochondrial":             EchinodermFlatwormMitochondrial,
+		"euplotid-nuclear":                   Euplotid,
+		"bacterial":                          BacterialArchaealPlantPlastid,
+		"archaeal":                           BacterialArchaealPlantPlastid,
+		"plant-plastid":                      BacterialArchaealPlantPlastid,
+		"alternative-yeast-nuclear":          AlternativeYeast,
+		"ascidian-mitochondrial":             AscidianMitochondrial,
+		"alternative-flatworm-mitochondrial": AlternativeFlatwormMitochondrial,
+		"chlorophycean-mitochondrial":        ChlorophyceanMitochondrial,
+		"trematode-mitochondrial":            TrematodeMitochondrial,
+		"scenedesmus-obliquus-mitochondrial": ScenedesmusObliquusMitochondrial,
+		"thraustochytrium-mitochondrial":     ThraustochytriumMitochondrial,
+		"pterobranchia-mitochondrial":        PterobranchiaMitochondrial,
+		"candidate-division-sr1":             CandidateDivisionSR1Gracilibacteria,
+		"gracilibacteria":                    CandidateDivisionSR1Gracilibacteria,
+		"pachysolen-tannophilus-nuclear":     PachysolenTannophilus,
+		"mesodinium-nuclear":                 Mesodinium,
+		"peritrich-nuclear":                  Peritrich,
+	}
+
+	// start codons of each table, from the 'Starts' line of the NCBI tables.
+	// table 0 is the standard code without alternative initiation codons
+	starts = map[int][]string{
+		Standard:                      {"ATG"},
+		StandardAlternativeInitiation: {"TTG", "CTG", "ATG"},
+		VertebrateMitochondrial:       {"ATT", "ATC", "ATA", "ATG", "GTG"},
+		YeastMitochondrial:            {"ATA", "ATG", "GTG"},
+		MoldProtozoanCoelenterateMitochondrialMycoplasmaSpiroplasma: {"TTA", "TTG", "CTG", "ATT", "ATC", "ATA", "ATG", "GTG"},
+		InvertebrateMitochondrial:                                   {"TTG", "ATT", "ATC", "ATA", "ATG", "GTG"},
+		CiliateDasycladaceanHexamita:                                {"ATG"},
+		EchinodermFlatwormMitochondrial:                             {"ATG", "GTG"},
+		Euplotid:                                                    {"ATG"},
+		BacterialArchaealPlantPlastid:                               {"TTG", "CTG", "ATT", "ATC", "ATA", "ATG", "GTG"},
+		AlternativeYeast:                                            {"CTG", "ATG"},
+		AscidianMitochondrial:                                       {"TTG", "ATA", "ATG", "GTG"},
+		AlternativeFlatwormMitochondrial:                            {"ATG"},
+		ChlorophyceanMitochondrial:                                  {"ATG"},
+		TrematodeMitochondrial:                                      {"ATG", "GTG"},
+		ScenedesmusObliquusMitochondrial:                            {"ATG"},
+		ThraustochytriumMitochondrial:                               {"ATT", "ATG", "GTG"},
+		PterobranchiaMitochondrial:                                  {"TTG", "CTG", "ATG", "GTG"},
+		CandidateDivisionSR1Gracilibacteria:                         {"TTG", "ATG", "GTG"},
+		PachysolenTannophilus:                                       {"CTG", "ATG"},
+		Mesodinium:                                                  {"ATG"},
+		Peritrich:                                                   {"ATG"},
+	}
 )
 
 const (
 	Standard                                                    = 0
+	StandardAlternativeInitiation                               = 1
 	VertebrateMitochondrial                                     = 2
 	YeastMitochondrial                                          = 3
 	MoldProtozoanCoelenterateMitochondrialMycoplasmaSpiroplasma = 4
@@ -372,7 +468,7 @@ func LoadTableCode(code int) (map[string]byte, error) {
 
 		tableDiff, ok := diffs[code]
 		if !ok {
-			return nil, fmt.Errorf("invalid table code: %v", code)
+			return nil, unsupportedTableError(code)
 		}
 
 		for codon, aaCode := range tableDiff {
@@ -383,3 +479,157 @@ func LoadTableCode(code int) (map[string]byte, error) {
 	}
 	return tableCodon, nil
 }
+
+// CodonChange is a codon translated to another AA than in the standard code
+type CodonChange struct {
+	// codon with a 'T', like 'TGA'
+	Codon string
+	// AA of the codon in the standard code, and in the table
+	Standard byte
+	AA       byte
+}
+
+// TableDiff returns the codons of a table translated to another
+// AA than in the standard code, sorted by codon
+func TableDiff(code int) ([]CodonChange, error) {
+
+	tableCodon, err := LoadTableCode(code)
+	if err != nil {
+		return nil, err
+	}
+
+	var changes []CodonChange
+	for codon, aaCode := range tableCodon {
+		if standardCode := standard[codon]; aaCode != standardCode {
+			changes = append(changes, CodonChange{Codon: codon, Standard: standardCode, AA: aaCode})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Codon < changes[j].Codon
+	})
+	return changes, nil
+}
+
+// TableCodes returns the codes of all supported tables, sorted
+func TableCodes() []int {
+
+	codes := make([]int, 0, len(names))
+	for code := range names {
+		codes = append(codes, code)
+	}
+	sort.Ints(codes)
+	return codes
+}
+
+// TableNames returns a map of table code <-> table name
+func TableNames() map[int]string {
+
+	r := make(map[int]string, len(names))
+	for code, name := range names {
+		r[code] = name
+	}
+	return r
+}
+
+// TableAliases returns the short names of each table code, sorted
+func TableAliases() map[int][]string {
+
+	r := make(map[int][]string, len(names))
+	for alias, code := range aliases {
+		r[code] = append(r[code], alias)
+	}
+	for _, a := range r {
+		sort.Strings(a)
+	}
+	return r
+}
+
+// TableCodeByName returns the code of a table from one of its short
+// names, like 'vertebrate-mitochondrial'. Names are case insensitive
+func TableCodeByName(name string) (int, error) {
+
+	code, ok := aliases[strings.ToLower(name)]
+	if !ok {
+		return 0, fmt.Errorf("unknown table name: %s", name)
+	}
+	return code, nil
+}
+
+func unsupportedTableError(code int) error {
+
+	codes := TableCodes()
+	supported := make([]string, 0, len(codes))
+	for _, c := range codes {
+		supported = append(supported, strconv.Itoa(c))
+	}
+	return fmt.Errorf("unsupported table code: %d, supported codes are %s", code, strings.Join(supported, ", "))
+}
+
+// LoadStartCodons returns the list of start codons of a table
+func LoadStartCodons(code int) ([]string, error) {
+
+	startCodons, ok := starts[code]
+	if !ok {
+		return nil, unsupportedTableError(code)
+	}
+	return startCodons, nil
+}
+
+// ReadTableCode reads a custom map of codon <-> AA. Each line
+// of the input holds a codon and its AA separated by a tab:
+//
+//	TAA	Q
+//
+// AA can be any character, like 'U' for selenocysteine or 'O' for
+// pyrrolysine. Empty lines and lines starting with '#' are ignored
+func ReadTableCode(r io.Reader) (map[string]byte, error) {
+
+	tableCodon := map[string]byte{}
+
+	scanner := bufio.NewScanner(r)
+	lineNumber := 0
+	for scanner.Scan() {
+
+		lineNumber++
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 || line[0] == '#' {
+			continue
+		}
+
+		fields := bytes.Split(line, []byte{'\t'})
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("line %d: expected 'codon<TAB>AA' but got '%s'", lineNumber, line)
+		}
+
+		codon, aa := fields[0], bytes.TrimSpace(fields[1])
+		if !isValidCodon(codon) {
+			return nil, fmt.Errorf("line %d: invalid codon '%s', must be three characters among A, C, G, T", lineNumber, codon)
+		}
+		if len(aa) != 1 {
+			return nil, fmt.Errorf("line %d: invalid AA '%s', must be a single character", lineNumber, aa)
+		}
+		if _, ok := tableCodon[string(codon)]; ok {
+			return nil, fmt.Errorf("line %d: duplicate codon '%s'", lineNumber, codon)
+		}
+		tableCodon[string(codon)] = aa[0]
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return tableCodon, nil
+}
+
+func isValidCodon(codon []byte) bool {
+
+	if len(codon) != 3 {
+		return false
+	}
+	for _, n := range codon {
+		switch n {
+		case 'A', 'C', 'G', 'T':
+		default:
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,193 @@
+package ncbicode_test
+
+import (
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/feliixx/gotranseq/ncbicode"
+)
+
+func TestTableCodes(t *testing.T) {
+
+	codes := ncbicode.TableCodes()
+	if !sort.IntsAreSorted(codes) {
+		t.Errorf("table codes are not sorted: %v", codes)
+	}
+
+	names := ncbicode.TableNames()
+	if len(codes) != len(names) {
+		t.Errorf("expected %d codes but got %d", len(names), len(codes))
+	}
+
+	for _, code := range codes {
+		if names[code] == "" {
+			t.Errorf("no name for table %d", code)
+		}
+		if _, err := ncbicode.LoadTableCode(code); err != nil {
+			t.Errorf("table %d is listed but can't be loaded: %v", code, err)
+		}
+	}
+
+	if want, got := "The Vertebrate Mitochondrial Code", names[ncbicode.VertebrateMitochondrial]; want != got {
+		t.Errorf("expected name %s but got %s", want, got)
+	}
+}
+
+func TestReadTableCode(t *testing.T) {
+
+	tests := []struct {
+		name  string
+		input string
+		err   bool
+	}{
+		{
+			name:  "valid",
+			input: "# comment\nTAA\tQ\n\nTAG\t*\n",
+		},
+		{
+			name:  "codon too short",
+			input: "TA\tQ\n",
+			err:   true,
+		},
+		{
+			name:  "invalid nucleotide",
+			input: "TAU\tQ\n",
+			err:   true,
+		},
+		{
+			name:  "duplicate codon",
+			input: "TAA\tQ\nTAA\t*\n",
+			err:   true,
+		},
+		{
+			name:  "missing AA",
+			input: "TAA\n",
+			err:   true,
+		},
+		{
+			name:  "AA too long",
+			input: "TAA\tGln\n",
+			err:   true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			codeMap, err := ncbicode.ReadTableCode(strings.NewReader(test.input))
+			if test.err {
+				if err == nil {
+					t.Errorf("expected an error but got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Error(err)
+			}
+			if want, got := byte('Q'), codeMap["TAA"]; want != got {
+				t.Errorf("expected %c for TAA but got %c", want, got)
+			}
+		})
+	}
+}
+
+func TestLoadTableCodeDoesNotAlterStandard(t *testing.T) {
+
+	pristine, err := ncbicode.LoadTableCode(ncbicode.Standard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, code := range ncbicode.TableCodes() {
+		if _, err := ncbicode.LoadTableCode(code); err != nil {
+			t.Fatal(err)
+		}
+	}
+	standard, err := ncbicode.LoadTableCode(ncbicode.Standard)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(pristine) != 64 || len(standard) != 64 {
+		t.Errorf("expected 64 codons, got %d and %d", len(pristine), len(standard))
+	}
+	for codon, aa := range pristine {
+		if standard[codon] != aa {
+			t.Errorf("codon %s: expected %c but got %c", codon, aa, standard[codon])
+		}
+	}
+	// codons reassigned by table 2
+	for codon, aa := range map[string]byte{"AGA": 'R', "AGG": 'R', "ATA": 'I', "TGA": '*'} {
+		if standard[codon] != aa {
+			t.Errorf("codon %s: expected %c but got %c", codon, aa, standard[codon])
+		}
+	}
+}
+
+func TestUnsupportedTableCode(t *testing.T) {
+
+	for _, code := range []int{-1, 7, 8, 31, 32} {
+		_, err := ncbicode.LoadTableCode(code)
+		if err == nil {
+			t.Errorf("expected an error for table %d", code)
+			continue
+		}
+		if !strings.Contains(err.Error(), "unsupported table code") {
+			t.Errorf("unexpected error for table %d: %v", code, err)
+		}
+		if _, err := ncbicode.LoadStartCodons(code); err == nil {
+			t.Errorf("expected an error for start codons of table %d", code)
+		}
+	}
+	for _, code := range []int{0, 1, 30} {
+		if _, err := ncbicode.LoadTableCode(code); err != nil {
+			t.Errorf("unexpected error for table %d: %v", code, err)
+		}
+	}
+}
+
+func TestTableCodeByName(t *testing.T) {
+
+	tests := []struct {
+		name string
+		code int
+	}{
+		{name: "standard", code: ncbicode.Standard},
+		{name: "vertebrate-mitochondrial", code: ncbicode.VertebrateMitochondrial},
+		{name: "Vertebrate-Mitochondrial", code: ncbicode.VertebrateMitochondrial},
+		{name: "mycoplasma", code: ncbicode.MoldProtozoanCoelenterateMitochondrialMycoplasmaSpiroplasma},
+		{name: "bacterial", code: ncbicode.BacterialArchaealPlantPlastid},
+		{name: "plant-plastid", code: ncbicode.BacterialArchaealPlantPlastid},
+		{name: "peritrich-nuclear", code: ncbicode.Peritrich},
+	}
+	for _, test := range tests {
+		code, err := ncbicode.TableCodeByName(test.name)
+		if err != nil {
+			t.Errorf("unexpected error for %s: %v", test.name, err)
+		}
+		if code != test.code {
+			t.Errorf("expected code %d for %s but got %d", test.code, test.name, code)
+		}
+	}
+
+	for _, name := range []string{"", "vertebrate", "2", "vertebrate mitochondrial"} {
+		if _, err := ncbicode.TableCodeByName(name); err == nil || !strings.Contains(err.Error(), "unknown table name") {
+			t.Errorf("expected an error for name '%s' but got %v", name, err)
+		}
+	}
+
+	// all tables have a name, and all names resolve to a supported table
+	aliases := ncbicode.TableAliases()
+	for _, code := range ncbicode.TableCodes() {
+		if len(aliases[code]) == 0 {
+			t.Errorf("no name for table %d", code)
+		}
+		for _, alias := range aliases[code] {
+			if got, _ := ncbicode.TableCodeByName(alias); got != code {
+				t.Errorf("expected code %d for %s but got %d", code, alias, got)
+			}
+		}
+	}
+	if len(aliases) != len(ncbicode.TableCodes()) {
+		t.Errorf("names for unsupported tables: %v", aliases)
+	}
+}
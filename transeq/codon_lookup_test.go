@@ -0,0 +1,62 @@
+package transeq
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/feliixx/gotranseq/ncbicode"
+)
+
+// compare the lookup of codons in the code array used by translateFrame
+// with the lookup in a map[uint32]byte holding the same codes
+func BenchmarkCodonLookup(b *testing.B) {
+
+	codeMap, err := ncbicode.LoadTableCode(ncbicode.Standard)
+	if err != nil {
+		b.Fatal(err)
+	}
+	arrayCode := createArrayCode(codeMap)
+
+	mapCode := map[uint32]byte{}
+	for code, aa := range arrayCode {
+		if aa != 0 {
+			mapCode[uint32(code)] = aa
+		}
+	}
+
+	// random codons, with a few 'N'
+	r := rand.New(rand.NewSource(1))
+	nucleotides := []byte{aCode, cCode, gCode, tCode, aCode, cCode, gCode, tCode, nCode}
+	codons := make([]uint32, 4096)
+	for i := range codons {
+		codons[i] = uint32(nucleotides[r.Intn(len(nucleotides))]) |
+			uint32(nucleotides[r.Intn(len(nucleotides))])<<8 |
+			uint32(nucleotides[r.Intn(len(nucleotides))])<<16
+	}
+
+	// check that both lookups give the same AA
+	for _, codon := range codons {
+		if arrayCode[codon] != mapCode[codon] {
+			b.Fatalf("codon %x: %c in array but %c in map", codon, arrayCode[codon], mapCode[codon])
+		}
+	}
+
+	var sink byte
+	b.Run("array", func(b *testing.B) {
+		b.SetBytes(int64(3 * len(codons)))
+		for n := 0; n < b.N; n++ {
+			for _, codon := range codons {
+				sink += arrayCode[codon]
+			}
+		}
+	})
+	b.Run("map", func(b *testing.B) {
+		b.SetBytes(int64(3 * len(codons)))
+		for n := 0; n < b.N; n++ {
+			for _, codon := range codons {
+				sink += mapCode[codon]
+			}
+		}
+	})
+	_ = sink
+}
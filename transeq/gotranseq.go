@@ -3,11 +3,26 @@ package transeq
 import (
 	"bufio"
 	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
 	"context"
 	"encoding/binary"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"os"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/feliixx/gotranseq/ncbicode"
 )
@@ -17,28 +32,125 @@ type Options struct {
 	Required `group:"required"`
 	Optional `group:"optional"`
 	General  `group:"general"`
+	// if not nil, updated during the translation
+	Progress *Progress `no-flag:"true"`
+	// where to write warnings about the input. If nil, they
+	// are written to stderr
+	Warnings io.Writer `no-flag:"true"`
+	// if not nil, statistics on each sequence are written to it,
+	// see --stats
+	Stats io.Writer `no-flag:"true"`
+	// if not nil, the codon usage of all sequences is written to
+	// it once all sequences are translated, see --codon-usage
+	CodonUsage io.Writer `no-flag:"true"`
+	// if not nil, the positions of the ORFs are written to it
+	// in BED format, see --bed
+	BED io.Writer `no-flag:"true"`
+	// if not nil, the ORFs are written to it as CDS features in
+	// GFF3 format, see --gff
+	GFF io.Writer `no-flag:"true"`
+	// if not nil, the nb of each AA of all proteins is written to
+	// it once all sequences are translated, see --composition
+	Composition io.Writer `no-flag:"true"`
+	// if not nil, the translation is interrupted once it's done, like
+	// on SIGINT. The sequences translated before are still written,
+	// and ErrInterrupted is returned
+	Context context.Context `no-flag:"true"`
+}
+
+// ErrInterrupted is returned when Options.Context is done before the
+// end of the translation
+var ErrInterrupted = errors.New("translation interrupted")
+
+// returns the context of the options, or an empty context if none is set
+func parentContext(options Options) context.Context {
+	if options.Context != nil {
+		return options.Context
+	}
+	return context.Background()
 }
 
 // Required struct to store required command line args
 type Required struct {
-	Sequence string `short:"s" long:"sequence" value-name:"<filename>" description:"Nucleotide sequence(s) filename"`
-	Outseq   string `short:"o" long:"outseq" value-name:"<filename>" description:"Protein sequence filename"`
+	Sequence []string `short:"s" long:"sequence" value-name:"<filename>" description:"Nucleotide sequence(s) filename, '-' for stdin, or an http or https URL. Can be repeated or be a comma-separated list of files"`
+	Outseq   string   `short:"o" long:"outseq" value-name:"<filename>" description:"Protein sequence filename, '-' for stdout"`
 }
 
 // Optional struct to store required command line args
 type Optional struct {
-	Frame       string `short:"f" long:"frame" value-name:"<code>" description:"Frame to translate. Possible values:\n  [1, 2, 3, F, -1, -2, -3, R, 6]\n F: forward three frames\n R: reverse three frames\n 6: all 6 frames\n" default:"1"`
-	Table       int    `short:"t" long:"table" value-name:"<code>" description:"NCBI code to use, see https://www.ncbi.nlm.nih.gov/Taxonomy/Utils/wprintgc.cgi?chapter=tgencodes#SG1 for details. Available codes: \n 0: Standard code\n 2: The Vertebrate Mitochondrial Code\n 3: The Yeast Mitochondrial Code\n 4: The Mold, Protozoan, and Coelenterate Mitochondrial Code and the Mycoplasma/Spiroplasma Code\n 5: The Invertebrate Mitochondrial Code\n 6: The Ciliate, Dasycladacean and Hexamita Nuclear Code\n 9: The Echinoderm and Flatworm Mitochondrial Code\n 10: The Euplotid Nuclear Code\n 11: The Bacterial, Archaeal and Plant Plastid Code\n 12: The Alternative Yeast Nuclear Code\n 13: The Ascidian Mitochondrial Code\n 14: The Alternative Flatworm Mitochondrial Code\n16: Chlorophycean Mitochondrial Code\n 21: Trematode Mitochondrial Code\n22: Scenedesmus obliquus Mitochondrial Code\n 23: Thraustochytrium Mitochondrial Code\n 24: Pterobranchia Mitochondrial Code\n 25: Candidate Division SR1 and Gracilibacteria Code\n 26: Pachysolen tannophilus Nuclear Code\n 29: Mesodinium Nuclear\n 30: Peritrich Nuclear\n" default:"0"`
-	Clean       bool   `short:"c" long:"clean" description:"Replace stop codon '*' by 'X'"`
-	Alternative bool   `short:"a" long:"alternative" description:"Define frame '-1' as using the set of codons starting with the last codon of the sequence"`
-	Trim        bool   `short:"T" long:"trim" description:"Removes all 'X' and '*' characters from the right end of the translation. The trimming process starts at the end and continues until the next character is not a 'X' or a '*'"`
-	NumWorker   int    `short:"n" long:"numcpu" value-name:"<n>" description:"Number of threads to use, default is number of CPU"`
+	Frame            string        `short:"f" long:"frame" value-name:"<code>" description:"Frame to translate. Possible values:\n  [1, 2, 3, F, -1, -2, -3, R, 6]\n F: forward three frames\n R: reverse three frames\n 6: all 6 frames\nSeveral values can be combined in a comma-separated list, like '1,3,-2',\nor given as a range, like '-3..3' for all 6 frames\n" default:"1"`
+	Table            int           `short:"t" long:"table" value-name:"<code>" description:"NCBI code to use, see https://www.ncbi.nlm.nih.gov/Taxonomy/Utils/wprintgc.cgi?chapter=tgencodes#SG1 for details. Available codes: \n 0: Standard code\n 1: Standard code with alternative initiation codons\n 2: The Vertebrate Mitochondrial Code\n 3: The Yeast Mitochondrial Code\n 4: The Mold, Protozoan, and Coelenterate Mitochondrial Code and the Mycoplasma/Spiroplasma Code\n 5: The Invertebrate Mitochondrial Code\n 6: The Ciliate, Dasycladacean and Hexamita Nuclear Code\n 9: The Echinoderm and Flatworm Mitochondrial Code\n 10: The Euplotid Nuclear Code\n 11: The Bacterial, Archaeal and Plant Plastid Code\n 12: The Alternative Yeast Nuclear Code\n 13: The Ascidian Mitochondrial Code\n 14: The Alternative Flatworm Mitochondrial Code\n16: Chlorophycean Mitochondrial Code\n 21: Trematode Mitochondrial Code\n22: Scenedesmus obliquus Mitochondrial Code\n 23: Thraustochytrium Mitochondrial Code\n 24: Pterobranchia Mitochondrial Code\n 25: Candidate Division SR1 and Gracilibacteria Code\n 26: Pachysolen tannophilus Nuclear Code\n 29: Mesodinium Nuclear\n 30: Peritrich Nuclear\n" default:"0"`
+	Clean            bool          `short:"c" long:"clean" description:"Replace stop codon '*' by 'X'"`
+	Alternative      bool          `short:"a" long:"alternative" description:"Define frame '-1' as using the set of codons starting with the last codon of the sequence"`
+	Trim             bool          `short:"T" long:"trim" description:"Removes all 'X' and '*' characters from the right end of the translation. The trimming process starts at the end and continues until the next character is not a 'X' or a '*'"`
+	NumWorker        int           `short:"n" long:"numcpu" value-name:"<n>" description:"Number of threads to use. Default is the value of the GOTRANSEQ_WORKERS environment variable if set, or the number of CPU"`
+	MaxMemory        string        `long:"max-memory" value-name:"<size>" description:"Abort the translation if the sequences read in advance and the translations waiting to be written take more than size bytes, like '2GB' or '512MB'. It's an approximation checked while writing, not a hard limit. No limit by default"`
+	Timeout          time.Duration `long:"timeout" value-name:"<duration>" description:"Abort the translation if it's not done after this duration, like '30s' or '5m'. No timeout by default"`
+	FlushBytes       int           `long:"flush-bytes" value-name:"<n>" description:"Write the translations to the output once more than n bytes are buffered. Default is 30MB, or to write each sequence once translated when writing to a terminal"`
+	QueueDepth       int           `long:"queue-depth" value-name:"<n>" description:"Number of sequences read in advance, waiting for a thread to translate them. Default is twice the number of threads"`
+	AlternativeStart bool          `long:"alternative-start" description:"Translate the first codon of each frame to 'M' if it's a start codon of the selected table. Not supported with --table-file"`
+	ForceStartMet    bool          `long:"force-start-met" description:"Translate the first codon of each frame to 'M', whatever the codon. Unlike --alternative-start, the codon doesn't have to be a start codon"`
+	TableName        string        `long:"table-name" value-name:"<name>" description:"Name of the NCBI code to use, like 'vertebrate-mitochondrial' or 'bacterial'. Overrides -t | --table. See --list-tables for the names of each code"`
+	TableFile        string        `long:"table-file" value-name:"<filename>" description:"File containing a custom genetic code, one 'codon<TAB>AA' per line, like 'TGA<TAB>U' to translate TGA to selenocysteine. Overrides -t | --table"`
+	ReplaceInternal  string        `long:"replace-internal-stops" value-name:"<char>" description:"Replace the stops of each frame by this character, like 'X', except a stop at the end of the frame. Unlike --clean, the terminal stop is kept"`
+	PreserveCase     bool          `long:"preserve-case" description:"Write in lowercase the AA of codons with 3 lowercase nucleotides, like soft-masked regions. Other AA, 'X' and stops are written in uppercase"`
+	MaskLowComplex   int           `long:"mask-lowcomplexity" value-name:"<n>" description:"Replace the runs of at least n times the same AA by 'X', like 'QQQQQQ', to prepare homology searches"`
+	MinProteinLen    int           `long:"min-protein-len" value-name:"<n>" description:"Don't write the frames with less than n AA, after --trim. With --orf, ORFs with less than n AA are not written either"`
+	ORF              int           `long:"orf" value-name:"<minlen>" description:"Write the open reading frames of at least minlen AA, from a 'M' to the next stop, instead of whole frames. Headers are like '>id_<frame>_<n> [start - end]', where positions of the ORF on the nucleotide sequence include the stop codon"`
+	Format           string        `long:"format" value-name:"<format>" description:"Output format: 'fasta', 'tsv' to write one line per frame with the sequence id, the frame, the nb of AA and the protein, separated by tabs, or 'jsonl' to write one json object per frame with the fields id, frame, comment and protein" choice:"fasta" choice:"tsv" choice:"jsonl" default:"fasta"`
+	HeaderStyle      string        `long:"header-style" value-name:"<style>" description:"Style of the fasta headers: 'default' for '>id_<frame> comment', or 'emboss' to also append '(REVERSE SENSE)' to the headers of reverse frames, like EMBOSS" choice:"default" choice:"emboss" default:"default"`
+	TSVHeader        bool          `long:"tsv-header" description:"With --format tsv, start the output with a header line naming the columns. The header is not written to a file that already has content, like with --append"`
+	ThreeLetter      bool          `long:"three-letter" description:"Write three-letter AA codes separated by spaces, like 'Met Ala Stop', with the AA of 60 nucleotides per line, or of --line-width nucleotides"`
+	LineWidth        int           `long:"line-width" value-name:"<n>" description:"Nb of AA per line of the proteins in fasta format, whatever the nb of letters per AA. Default is 60, or 20 with --three-letter"`
+	FrameSuffixes    string        `long:"frame-suffixes" value-name:"<suffixes>" description:"Suffixes added after a '_' to the sequence ids for frames 1, 2, 3, -1, -2 and -3, separated by commas, like '1,2,3,r1,r2,r3'. Default is '1,2,3,4,5,6'"`
+	WarnAmbiguous    bool          `long:"warn-ambiguous" description:"For each sequence, print to stderr the nb of codons translated to 'X' because they contain a 'N'. Incomplete codons at the end of a frame are not counted"`
+	Circular         bool          `long:"circular" description:"Sequences are circular, like plasmids: codons spanning the end and the start of the sequence are translated"`
+	StripN           bool          `long:"strip-n" description:"Remove the 'N' at the start and at the end of each sequence before translating it, so the frames start at the first known nucleotide. 'N' inside the sequence are kept. Positions of --orf and --reverse-coords are on the sequence without the removed 'N'"`
+	Region           string        `long:"region" value-name:"<start>-<end>" description:"Only translate the region from start to end of each sequence, like '100-600'. Positions start at 1 and end is included"`
+	FirstN           int           `long:"first-n" value-name:"<n>" description:"Only translate the first n sequences of the inputs, and stop reading once they are read. Inputs are then read one at a time"`
+	Subsample        float64       `long:"subsample" value-name:"<fraction>" description:"Randomly keep this fraction of the sequences, like 0.1 for about 10% of the sequences. See --seed to keep the same sequences on each run"`
+	Seed             *int64        `long:"seed" value-name:"<n>" description:"Seed of the random selection of --subsample. With the same seed and inputs, the same sequences are kept, whatever the nb of threads. Default is a different selection on each run"`
+	Skip             int           `long:"skip" value-name:"<n>" description:"Skip the first n sequences of the inputs. With --first-n, translate the n sequences after the skipped ones, like '--skip 1000 --first-n 1000' for sequences 1001 to 2000. Inputs are then read one at a time"`
+	ID               string        `long:"id" value-name:"<id>" description:"Only translate the sequence with this id. The other sequences are skipped while reading"`
+	IDPrefix         bool          `long:"id-prefix" description:"With --id, translate all sequences whose id starts with the value of --id"`
+	CheckIDs         bool          `long:"check-ids" description:"Fail if several sequences have the same id"`
+	Dedup            bool          `long:"dedup" description:"Write each distinct protein only once, in the record of its first occurrence in the input. In fasta format, its header ends with 'dups=n', the nb of records not written. Proteins are compared after --trim, and with --concat-frames the concatenated proteins are compared. The records are kept in memory until all sequences are translated"`
+	ForceNucleotide  bool          `long:"force-nucleotide" description:"Translate the input files even if their first sequence looks like a protein sequence"`
+	Fastq            bool          `long:"fastq" description:"Input files are in fastq format. Quality lines are ignored and read ids are used as sequence ids"`
+	RejectEmpty      bool          `long:"reject-empty" description:"Fail if a sequence has no nucleotides, like when a header is directly followed by another header in a truncated file"`
+	SortByLength     bool          `long:"sort-by-length" description:"Write the records by decreasing protein length, records of the same length in the input order. The translations are kept in memory until all sequences are translated"`
+	ConcatFrames     bool          `long:"concat-frames" description:"Write all frames of a sequence in a single record, in the frame order and separated by a stop. The header is like '>id frames=1:1-20,2:22-41', with the positions of each frame in the protein"`
+	GroupByFrame     bool          `long:"group-by-frame" description:"Write all frame 1 records for all sequences, then all frame 2 records, and so on. The translations are kept in memory until all sequences are translated"`
+	StatsFile        string        `long:"stats" value-name:"<filename>" description:"Write a tab-separated report with the id, the nb of nucleotides, the GC content in percent and the nb of stop codons of each translated frame of each sequence. Not supported with --frame-from-header"`
+	ReverseCoords    bool          `long:"reverse-coords" description:"Add to the headers of reverse frames the positions of their first and last nucleotides on the forward sequence, like '>id_4 [120 - 1]'. Positions start at 1. Ignored with --orf"`
+	AnnotateLength   bool          `long:"annotate-length" description:"Append the nb of nucleotides of the sequence to the fasta headers, like '>id_1 comment len=1234'. With --region or --strip-n, only the nucleotides translated are counted"`
+	RNAOutput        bool          `long:"rna-output" description:"Append 'molecule=RNA' to the fasta headers of the sequences with a 'U', and write the codons of --codon-usage with 'U' instead of 'T'"`
+	NoComment        bool          `long:"no-comment" description:"Drop the comments of the sequences, headers are only like '>id_<frame>'"`
+	BEDFile          string        `long:"bed" value-name:"<filename>" description:"With --orf, write the positions of the ORFs in BED format, one line per ORF with the sequence id, the start and the end of the ORF, its name like 'id_<frame>_<n>', a score of 0 and the strand. Start positions begin at 0 and end positions are excluded, as in BED files"`
+	GFFFile          string        `long:"gff" value-name:"<filename>" description:"With --orf, write the ORFs as CDS features in GFF3 format, with the sequence id as seqid and an ID like 'id_<frame>_<n>'. Positions begin at 1 and include the stop codon"`
+	CompositionFile  string        `long:"composition" value-name:"<filename>" description:"Write a tab-separated table with the nb of occurrences of each AA in all written proteins, and its frequency. Stop codons are counted as '*' and codons that can't be translated as 'X', whatever the output characters"`
+	CodonUsageFile   string        `long:"codon-usage" value-name:"<filename>" description:"Write a tab-separated table with the nb of occurrences of each of the 64 codons in frame 1 of all sequences, with its AA and its frequency. Codons with a 'N' or a gap are not counted"`
+	FrameFromHeader  bool          `long:"frame-from-header" description:"If the comment of a sequence has a tag like 'frame=2', only translate the frames of the tag for this sequence. Tags take the same values as -f | --frame. Sequences without tag are translated in the frames of -f | --frame. Not supported with --split or --stats"`
+	Mkdir            bool          `long:"mkdir" description:"Create the directories of the output files if they don't exist"`
+	Append           bool          `long:"append" description:"Append the proteins to the output file instead of overwriting it, or to the output files with --split"`
+	Split            bool          `long:"split" description:"Write each frame to a separate file, named like <outseq>_<frame>.<ext>"`
+	SplitStrand      bool          `long:"split-strand" description:"Write the forward frames and the reverse frames to two separate files, named like <outseq>_forward.<ext> and <outseq>_reverse.<ext>"`
+	StopChar         string        `long:"stopchar" value-name:"<char>" description:"Character to use for stop codons. Ignored if --clean is set. With --trim, trailing stop characters are removed" default:"*"`
+	UnknownChar      string        `long:"unknown-char" value-name:"<char>" description:"Character to use for codons that can't be translated, because they contain a 'N' or are incomplete. Ignored with --three-letter" default:"X"`
+	InternalUnknown  string        `long:"internal-unknown" value-name:"<char>" description:"Character to use for the complete codons that can't be translated, like codons with a 'N'. Default is the value of --unknown-char"`
+	TerminalUnknown  string        `long:"terminal-unknown" value-name:"<char>" description:"Character to use for the incomplete codon at the end of a frame, if it can't be translated. Default is the value of --unknown-char"`
 }
 
 // General struct to store required command line args
 type General struct {
-	Help    bool `short:"h" long:"help" description:"Show this help message"`
-	Version bool `short:"v" long:"version" description:"Print the tool version and exit"`
+	Help         bool `short:"h" long:"help" description:"Show this help message"`
+	Version      bool `short:"v" long:"version" description:"Print the tool version and exit"`
+	ListTables   bool `long:"list-tables" description:"Print the list of supported NCBI tables and exit"`
+	DumpTable    int  `long:"dump-table" value-name:"<code>" description:"Print the codons of a NCBI table translated to another AA than in the standard code, sorted by codon, and exit"`
+	Verbose      bool `long:"verbose" description:"Print a summary of the translation to stderr"`
+	ShowProgress bool `long:"progress" description:"Print the progress of the translation to stderr"`
+	Quiet        bool `short:"q" long:"quiet" description:"Don't print anything to stderr, not even warnings. Overrides --verbose and --progress. Errors are still printed"`
+	Validate     bool `long:"validate" description:"Only check that the input files are valid fasta files, without translating them. Invalid characters, duplicate ids and empty sequences are errors"`
 }
 
 var letterCode = map[byte]uint8{
@@ -57,26 +169,52 @@ const (
 	tCode = uint8(3)
 	uCode = uint8(3)
 	gCode = uint8(4)
+	// gap in aligned sequences
+	gapCode = uint8(5)
+	// IUPAC ambiguity code, like 'R' or 'Y'. They are not resolved, so
+	// the codons with one of them are translated to 'X', unless it's the
+	// last nucleotide and the two first ones are enough, like in 'GCR'
+	ambiguousCode = uint8(6)
+	// set on the code of lowercase nucleotides with --preserve-case,
+	// and removed before the translation
+	softMasked = uint8(1 << 3)
 
 	stopByte = '*'
 	unknown  = 'X'
+	gap      = '-'
 	// Length of the array to store code/bytes
-	// uses gCode because it's the biggest uint8 of all codes
-	arrayCodeSize = (uint32(gCode) | uint32(gCode)<<8 | uint32(gCode)<<16) + 1
+	// uses ambiguousCode because it's the biggest uint8 of all codes
+	arrayCodeSize = (uint32(ambiguousCode) | uint32(ambiguousCode)<<8 | uint32(ambiguousCode)<<16) + 1
 )
 
-// create the code map according to the selected table code
-func createArrayCode(code int, clean bool) ([]byte, error) {
+// load the codon <-> AA map, either from the table file if specified,
+// or from the selected table code
+func loadCodeMap(options Options) (map[string]byte, error) {
 
-	resultMap := map[uint32]byte{}
-	twoLetterMap := map[string][]byte{}
-
-	tmpCode := make([]uint8, 4)
+	if options.TableFile == "" {
+		return ncbicode.LoadTableCode(options.Table)
+	}
 
-	codeMap, err := ncbicode.LoadTableCode(code)
+	f, err := os.Open(options.TableFile)
 	if err != nil {
 		return nil, err
 	}
+	defer f.Close()
+
+	codeMap, err := ncbicode.ReadTableCode(f)
+	if err != nil {
+		return nil, fmt.Errorf("invalid table file %s: %v", options.TableFile, err)
+	}
+	return codeMap, nil
+}
+
+// create the code array from the codon <-> AA map
+func createArrayCode(codeMap map[string]byte) []byte {
+
+	resultMap := map[uint32]byte{}
+	twoLetterMap := map[string][]byte{}
+
+	tmpCode := make([]uint8, 4)
 
 	for codon, aaCode := range codeMap {
 		// generate 3 letter code
@@ -101,7 +239,10 @@ func createArrayCode(code int, clean bool) ([]byte, error) {
 		}
 	}
 	for twoLetterCodon, codes := range twoLetterMap {
-		uniqueAA := true
+		// the AA of a two letter codon is only known if the four codons
+		// starting with these letters have the same AA. Custom tables
+		// may not define all codons
+		uniqueAA := len(codes) == 4
 		for i := 0; i < len(codes); i++ {
 
 			if codes[i] != codes[0] {
@@ -116,454 +257,3221 @@ func createArrayCode(code int, clean bool) ([]byte, error) {
 			resultMap[uint32Code] = codes[0]
 		}
 	}
-	// if clean is specified, we want to replace all '*' by 'X' in the output
-	// sequence, so replace all occurrences of '*' directly in the ref map
-	if clean {
-		for k, v := range resultMap {
-			if v == stopByte {
-				resultMap[k] = unknown
-			}
-		}
-	}
+	// a codon made of three gaps is a gap in the protein. Codons
+	// with one or two gaps are unknown
+	resultMap[uint32(gapCode)|uint32(gapCode)<<8|uint32(gapCode)<<16] = gap
 
 	r := make([]byte, arrayCodeSize)
 	for k, v := range resultMap {
 		r[k] = v
 	}
-	return r, nil
+	return r
 }
 
-func computeFrames(frameName string) (frames []int, reverse bool, err error) {
+// create the start code array according to the selected table code:
+// each start codon is mapped to 'M', other codons are left to byte(0)
+func createStartArrayCode(code int) ([]byte, error) {
 
-	frames = make([]int, 6)
-	reverse = false
+	startCodons, err := ncbicode.LoadStartCodons(code)
+	if err != nil {
+		return nil, err
+	}
 
-	switch frameName {
-	case "1":
-		frames[0] = 1
-	case "2":
-		frames[1] = 1
-	case "3":
-		frames[2] = 1
-	case "F":
-		for i := 0; i < 3; i++ {
-			frames[i] = 1
-		}
-	case "-1":
-		frames[3] = 1
-		reverse = true
-	case "-2":
-		frames[4] = 1
-		reverse = true
-	case "-3":
-		frames[5] = 1
-		reverse = true
-	case "R":
-		for i := 3; i < 6; i++ {
-			frames[i] = 1
-		}
-		reverse = true
-	case "6":
-		for i := range frames {
-			frames[i] = 1
-		}
-		reverse = true
-	default:
-		err = fmt.Errorf("wrong value for -f | --frame parameter: %s", frameName)
+	r := make([]byte, arrayCodeSize)
+	for _, codon := range startCodons {
+		uint32Code := uint32(letterCode[codon[0]]) | uint32(letterCode[codon[1]])<<8 | uint32(letterCode[codon[2]])<<16
+		r[uint32Code] = 'M'
 	}
-	return frames, reverse, err
+	return r, nil
 }
 
-type writer struct {
-	buf            *bytes.Buffer
-	currentLineLen int
-	bytesToTrim    int
-}
+// environment variable holding the default nb of threads
+const workersEnv = "GOTRANSEQ_WORKERS"
 
-func (w *writer) addByte(b byte) {
-	w.buf.WriteByte(b)
-	w.currentLineLen++
-	if b == stopByte || b == unknown {
-		w.bytesToTrim++
-	} else {
-		w.bytesToTrim = 0
+// DefaultNumWorker returns the nb of threads to use when -n | --numcpu
+// is not set: the value of the GOTRANSEQ_WORKERS environment variable
+// if set, otherwise GOMAXPROCS, which is the nb of CPU unless limited
+func DefaultNumWorker() (int, error) {
+
+	value, ok := os.LookupEnv(workersEnv)
+	if !ok || value == "" {
+		return runtime.GOMAXPROCS(0), nil
+	}
+	numWorker, err := strconv.Atoi(value)
+	if err != nil || numWorker < 1 {
+		return 0, fmt.Errorf("wrong value for %s environment variable: %s, must be at least 1", workersEnv, value)
 	}
+	return numWorker, nil
 }
 
-func (w *writer) addUnknown() {
-	w.buf.WriteByte(unknown)
-	w.currentLineLen++
-	w.bytesToTrim++
-}
+// returns the capacity of the channels between the reader, the
+// workers and the writer
+func computeQueueDepth(options Options) (int, error) {
 
-func (w *writer) newLine() {
-	w.buf.WriteByte('\n')
-	w.currentLineLen = 0
-	w.bytesToTrim++
+	// the queue depth depends on the nb of workers, so check it first
+	if options.NumWorker < 1 {
+		return 0, fmt.Errorf("wrong value for -n | --numcpu parameter: %d, must be at least 1", options.NumWorker)
+	}
+
+	switch {
+	case options.QueueDepth < 0:
+		return 0, fmt.Errorf("wrong value for --queue-depth parameter: %d, must be positive", options.QueueDepth)
+	case options.QueueDepth == 0:
+		return 2 * options.NumWorker, nil
+	default:
+		return options.QueueDepth, nil
+	}
 }
 
-const (
-	// size of the buffer for writing to file
-	maxBufferSize = 1024 * 1024 * 30
-	// max line size for sequence
-	maxLineSize = 60
-	// suffixes ta add to sequence id for each frame
-	suffixes = "123456"
-)
+// units of the sizes of --max-memory
+var sizeUnits = []struct {
+	suffix string
+	bytes  int64
+}{
+	// longest suffixes first, as all end with 'B'
+	{"KB", 1 << 10},
+	{"MB", 1 << 20},
+	{"GB", 1 << 30},
+	{"TB", 1 << 40},
+	{"B", 1},
+}
 
-// Translate read a fata file, translate each sequence to the corresponding prot sequence in the specified frame
-func Translate(inputSequence io.Reader, out io.Writer, options Options) error {
+// returns the nb of bytes of a size like '2GB', '512MB' or '1024'
+func parseSize(paramName, value string) (int64, error) {
 
-	arrayCode, err := createArrayCode(options.Table, options.Clean)
-	if err != nil {
-		return err
+	number := strings.ToUpper(strings.TrimSpace(value))
+	unit := int64(1)
+	for _, u := range sizeUnits {
+		if strings.HasSuffix(number, u.suffix) {
+			number, unit = strings.TrimSpace(strings.TrimSuffix(number, u.suffix)), u.bytes
+			break
+		}
 	}
-
-	framesToGenerate, reverse, err := computeFrames(options.Frame)
-	if err != nil {
-		return err
+	n, err := strconv.ParseInt(number, 10, 64)
+	if err != nil || n < 1 {
+		return 0, fmt.Errorf("wrong value for --%s parameter: %s, must be a size like '2GB' or '512MB'", paramName, value)
 	}
+	return n * unit, nil
+}
 
-	fnaSequences := make(chan encodedSequence, 10)
-	errs := make(chan error, 1)
+// returns the byte to use in the output for a parameter like --stopchar,
+// or defaultChar if the parameter is empty
+func computeChar(paramName, value string, defaultChar byte) (byte, error) {
 
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
+	switch len(value) {
+	case 0:
+		return defaultChar, nil
+	case 1:
+		return value[0], nil
+	default:
+		return 0, fmt.Errorf("wrong value for --%s parameter: %s, must be a single character", paramName, value)
+	}
+}
 
-	var wg sync.WaitGroup
-	wg.Add(options.NumWorker)
+func computeFrames(frameName string) (frames []int, reverse bool, err error) {
 
-	for nWorker := 0; nWorker < options.NumWorker; nWorker++ {
+	frames = make([]int, 6)
+	reverse = false
 
-		go func() {
+	// frames can be a comma-separated list, like '1,3,-2'
+	for _, token := range strings.Split(frameName, ",") {
+
+		switch token {
+		case "1":
+			frames[0] = 1
+		case "2":
+			frames[1] = 1
+		case "3":
+			frames[2] = 1
+		case "F":
+			for i := 0; i < 3; i++ {
+				frames[i] = 1
+			}
+		case "-1":
+			frames[3] = 1
+			reverse = true
+		case "-2":
+			frames[4] = 1
+			reverse = true
+		case "-3":
+			frames[5] = 1
+			reverse = true
+		case "R":
+			for i := 3; i < 6; i++ {
+				frames[i] = 1
+			}
+			reverse = true
+		case "6":
+			for i := range frames {
+				frames[i] = 1
+			}
+			reverse = true
+		default:
+			if first, last, ok := frameRange(token); ok {
+				if first > last {
+					return frames, reverse, fmt.Errorf("wrong value for -f | --frame parameter: %s, invalid frame range '%s'", frameName, token)
+				}
+				for frame := first; frame <= last; frame++ {
+					switch {
+					case frame > 0:
+						frames[frame-1] = 1
+					case frame < 0:
+						frames[2-frame] = 1
+						reverse = true
+					}
+				}
+				continue
+			}
+			if token == frameName {
+				return frames, reverse, fmt.Errorf("wrong value for -f | --frame parameter: %s", frameName)
+			}
+			return frames, reverse, fmt.Errorf("wrong value for -f | --frame parameter: %s, invalid frame '%s'", frameName, token)
+		}
+	}
+	return frames, reverse, nil
+}
 
-			defer wg.Done()
+// parse a range of frames like '-3..3' or '1..2'. Both ends
+// must be a frame in [-3, -1] or [1, 3]
+func frameRange(token string) (first, last int, ok bool) {
 
-			startPosition := make([]int, 3)
+	parts := strings.SplitN(token, "..", 2)
+	if len(parts) != 2 {
+		return 0, 0, false
+	}
+	ends := [2]int{}
+	for i, part := range parts {
+		frame, err := strconv.Atoi(part)
+		if err != nil || frame == 0 || frame < -3 || frame > 3 {
+			return 0, 0, false
+		}
+		ends[i] = frame
+	}
+	return ends[0], ends[1], true
+}
 
-			w := &writer{
-				buf:            bytes.NewBuffer(nil),
-				bytesToTrim:    0,
-				currentLineLen: 0,
-			}
+// nb of codons translated to 'X' because they can't be translated,
+// by cause
+type unknownCodons struct {
+	// complete codons with a 'N'
+	n int
+	// complete codons with an ambiguity code, but no 'N'
+	ambiguous int
+	// incomplete codons at the end of the frames
+	incomplete int
+}
 
-			for sequence := range fnaSequences {
+func (u *unknownCodons) add(other unknownCodons) {
+	u.n += other.n
+	u.ambiguous += other.ambiguous
+	u.incomplete += other.incomplete
+}
 
-				select {
-				case <-ctx.Done():
-					return
-				default:
-				}
+// translate the frame of the nucleotide sequence starting at startPos,
+// and append the AA to prot. Also returns the nb of codons translated
+// to 'X' because of a 'N', an ambiguity code or an incomplete codon
+func translateFrame(prot []byte, nuclSequence []byte, startPos int, arrayCode, startArrayCode []byte) ([]byte, unknownCodons) {
 
-				frameIndex := 0
-				startPosition[0], startPosition[1], startPosition[2] = 0, 1, 2
+	var nbUnknown unknownCodons
+	// a frame starting after the end of a sequence shorter
+	// than 3 nucleotides is empty
+	if startPos >= len(nuclSequence) {
+		return prot, nbUnknown
+	}
 
-				idSize := int(binary.LittleEndian.Uint32(sequence[0:4]))
-				nuclSeqLength := len(sequence) - idSize
+	// read the sequence 3 letters at a time, starting at a specific position
+	// corresponding to the frame
+	firstCodonEnd := startPos + 2
+	for pos := firstCodonEnd; pos < len(nuclSequence); pos += 3 {
 
-			Translate:
-				for _, startPos := range startPosition {
+		// create an uint32 from the codon, to retrieve the corresponding
+		// AA from the map
+		codonCode := uint32(nuclSequence[pos-2]) | uint32(nuclSequence[pos-1])<<8 | uint32(nuclSequence[pos])<<16
 
-					if framesToGenerate[frameIndex] == 0 {
-						frameIndex++
-						continue
-					}
+		b := arrayCode[codonCode]
+		if b == byte(0) && nuclSequence[pos] == ambiguousCode {
+			// the AA of the two first nucleotides, if the four codons agree
+			b = arrayCode[codonCode&0xffff]
+		}
+		// the first codon of the frame is translated to 'M' if it's
+		// a start codon
+		if startArrayCode != nil && pos == firstCodonEnd && startArrayCode[codonCode] != byte(0) {
+			b = startArrayCode[codonCode]
+		}
+		if b == byte(0) {
+			b = unknown
+			switch {
+			case nuclSequence[pos-2] == nCode || nuclSequence[pos-1] == nCode || nuclSequence[pos] == nCode:
+				nbUnknown.n++
+			case nuclSequence[pos-2] == ambiguousCode || nuclSequence[pos-1] == ambiguousCode || nuclSequence[pos] == ambiguousCode:
+				nbUnknown.ambiguous++
+			}
+		}
+		prot = append(prot, b)
+	}
 
-					// sequence id should look like
-					// >sequenceID_<frame> comment
-					idEnd := bytes.IndexByte(sequence[4:idSize], ' ')
-					if idEnd != -1 {
-						w.buf.Write(sequence[4 : 4+idEnd])
-						w.buf.WriteByte('_')
-						w.buf.WriteByte(suffixes[frameIndex])
-						w.buf.Write(sequence[4+idEnd : idSize])
-					} else {
-						w.buf.Write(sequence[4:idSize])
-						w.buf.WriteByte('_')
-						w.buf.WriteByte(suffixes[frameIndex])
-					}
-					w.newLine()
+	switch (len(nuclSequence) - startPos) % 3 {
+	case 2:
+		// the last codon is only 2 nucleotid long, try to guess
+		// the corresponding AA. A 'N' in these 2 nucleotides makes
+		// it unknown, as the four possible codons can't all agree
+		codonCode := uint32(nuclSequence[len(nuclSequence)-2]) | uint32(nuclSequence[len(nuclSequence)-1])<<8
+
+		b := arrayCode[codonCode]
+		if b == byte(0) {
+			b = unknown
+			nbUnknown.incomplete++
+		}
+		prot = append(prot, b)
+	case 1:
+		// the last codon is only 1 nucleotid long, no way to guess
+		// the corresponding AA
+		prot = append(prot, unknown)
+		nbUnknown.incomplete++
+	}
+	return prot, nbUnknown
+}
 
-					// if in trim mode, nb of bytes to trim (nb of successive 'X', '*' and '\n'
-					// from right end of the sequence)
-					w.bytesToTrim = 0
-					w.currentLineLen = 0
+// returns the position of the first nucleotide of each frame. Positions of
+// the reverse frames are positions on the reverse-complemented sequence
+func frameStartPositions(nuclSeqLength int, alternative bool) [6]int {
+
+	positions := [6]int{0, 1, 2, 0, 1, 2}
+	if !alternative {
+		// Staden convention: Frame -1 is the reverse-complement of the sequence
+		// having the same codon phase as frame 1. Frame -2 is the same phase as
+		// frame 2. Frame -3 is the same phase as frame 3
+		//
+		// use the matrix to keep track of the forward frame as it depends on the
+		// length of the sequence
+		switch nuclSeqLength % 3 {
+		case 0:
+			positions[3], positions[4], positions[5] = 0, 2, 1
+		case 1:
+			positions[3], positions[4], positions[5] = 1, 0, 2
+		case 2:
+			positions[3], positions[4], positions[5] = 2, 1, 0
+		}
+	}
+	return positions
+}
 
-					// read the sequence 3 letters at a time, starting at a specific position
-					// corresponding to the frame
-					for pos := startPos + 2 + idSize; pos < len(sequence); pos += 3 {
+// reverse-complement an encoded nucleotide sequence in place
+func reverseComplement(nuclSequence []byte) {
+
+	// get the complementary sequence.
+	// Basically, switch
+	//   A <-> T
+	//   C <-> G
+	// N, ambiguity codes and gaps are not modified
+	for i, n := range nuclSequence {
+
+		switch n {
+		case aCode:
+			nuclSequence[i] = tCode
+		case tCode:
+			// handle both tCode and uCode
+			nuclSequence[i] = aCode
+		case cCode:
+			nuclSequence[i] = gCode
+		case gCode:
+			nuclSequence[i] = cCode
+		default:
+			//case N or gap -> leave it
+		}
+	}
+	// reverse the sequence
+	for i, j := 0, len(nuclSequence)-1; i < j; i, j = i+1, j-1 {
+		nuclSequence[i], nuclSequence[j] = nuclSequence[j], nuclSequence[i]
+	}
+}
 
-						if w.currentLineLen == maxLineSize {
-							w.newLine()
-						}
-						// create an uint32 from the codon, to retrieve the corresponding
-						// AA from the map
-						codonCode := uint32(sequence[pos-2]) | uint32(sequence[pos-1])<<8 | uint32(sequence[pos])<<16
-
-						b := arrayCode[codonCode]
-						if b != byte(0) {
-							w.addByte(b)
-						} else {
-							w.addUnknown()
-						}
-					}
+// remove all 'X' and '*' characters from the right end of the protein
+func trimRight(prot []byte) []byte {
 
-					// the last codon is only 2 nucleotid long, try to guess
-					// the corresponding AA
-					if (nuclSeqLength-startPos)%3 == 2 {
+	end := len(prot)
+	for end > 0 && (prot[end-1] == stopByte || prot[end-1] == unknown) {
+		end--
+	}
+	return prot[:end]
+}
 
-						if w.currentLineLen == maxLineSize {
-							w.newLine()
-						}
-						codonCode := uint32(sequence[len(sequence)-2]) | uint32(sequence[len(sequence)-1])<<8
+// replace the stops of prot by b, except a stop at its end. If incomplete
+// is set, the last AA is from an incomplete codon, so a stop just before
+// it is the terminal stop
+func replaceInternalStops(prot []byte, b byte, incomplete bool) {
 
-						b := arrayCode[codonCode]
-						if b != byte(0) {
-							w.addByte(b)
-						} else {
-							w.addUnknown()
-						}
-					}
+	terminal := len(prot) - 1
+	if incomplete {
+		terminal--
+	}
+	for i, aa := range prot {
+		if aa == stopByte && i != terminal {
+			prot[i] = b
+		}
+	}
+}
 
-					// the last codon is only 1 nucleotid long, no way to guess
-					// the corresponding AA
-					if (nuclSeqLength-startPos)%3 == 1 {
-						if w.currentLineLen == maxLineSize {
-							w.newLine()
-						}
-						w.addUnknown()
-					}
+// replace the runs of at least minLen times the same AA by 'X'.
+// Runs of 'X', stops or gaps are not changed
+func maskRepeats(prot []byte, minLen int) {
 
-					if options.Trim && w.bytesToTrim > 0 {
-						// remove the last bytesToTrim bytes of the buffer
-						// as they are 'X', '*' or '\n'
-						w.buf.Truncate(w.buf.Len() - w.bytesToTrim)
-						w.currentLineLen -= w.bytesToTrim
-					}
+	for start := 0; start < len(prot); {
+		end := start + 1
+		for end < len(prot) && prot[end] == prot[start] {
+			end++
+		}
+		if b := prot[start]; end-start >= minLen && b != unknown && b != stopByte && b != gap {
+			for i := start; i < end; i++ {
+				prot[i] = unknown
+			}
+		}
+		start = end
+	}
+}
 
-					if w.currentLineLen != 0 {
-						w.newLine()
-					}
-					frameIndex++
-				}
+// returns the positions of the soft-masked nucleotides of nuclSequence,
+// and remove the soft-masked bit from their code
+func softMaskedPositions(lower []bool, nuclSequence []byte) []bool {
 
-				if reverse && frameIndex < 6 {
-
-					// get the complementary sequence.
-					// Basically, switch
-					//   A <-> T
-					//   C <-> G
-					// N is not modified
-					for i, n := range sequence[idSize:] {
-
-						switch n {
-						case aCode:
-							sequence[i+idSize] = tCode
-						case tCode:
-							// handle both tCode and uCode
-							sequence[i+idSize] = aCode
-						case cCode:
-							sequence[i+idSize] = gCode
-						case gCode:
-							sequence[i+idSize] = cCode
-						default:
-							//case N -> leave it
-						}
-					}
-					// reverse the sequence
-					for i, j := idSize, len(sequence)-1; i < j; i, j = i+1, j-1 {
-						sequence[i], sequence[j] = sequence[j], sequence[i]
-					}
+	for i, n := range nuclSequence {
+		lower = append(lower, n&softMasked != 0)
+		nuclSequence[i] = n &^ softMasked
+	}
+	return lower
+}
 
-					if !options.Alternative {
-						// Staden convention: Frame -1 is the reverse-complement of the sequence
-						// having the same codon phase as frame 1. Frame -2 is the same phase as
-						// frame 2. Frame -3 is the same phase as frame 3
-						//
-						// use the matrix to keep track of the forward frame as it depends on the
-						// length of the sequence
-						switch nuclSeqLength % 3 {
-						case 0:
-							startPosition[0], startPosition[1], startPosition[2] = 0, 2, 1
-						case 1:
-							startPosition[0], startPosition[1], startPosition[2] = 1, 0, 2
-						case 2:
-							startPosition[0], startPosition[1], startPosition[2] = 2, 1, 0
-						}
-					}
-					// run the same loop, but with the reverse-complemented sequence
-					goto Translate
-				}
+// returns the soft-masked positions of the reverse-complemented sequence
+func reverseSoftMask(lower []bool) {
+	for i, j := 0, len(lower)-1; i < j; i, j = i+1, j-1 {
+		lower[i], lower[j] = lower[j], lower[i]
+	}
+}
 
-				if w.buf.Len() > maxBufferSize {
-					_, err := out.Write(w.buf.Bytes())
-					if err != nil {
-						select {
-						case errs <- fmt.Errorf("fail to write to output file: %v", err):
-						default:
-						}
-						cancel()
-						return
-					}
-					w.buf.Reset()
-				}
-				pool.Put(sequence)
-			}
+// write in lowercase the AA of prot translated from a codon of 3 soft-masked
+// nucleotides. 'X', stops and AA of an incomplete codon are not changed
+func lowerSoftMasked(prot []byte, lower []bool, startPos int) {
 
-			if w.buf.Len() > 0 {
-				_, err := out.Write(w.buf.Bytes())
-				if err != nil {
-					select {
-					case errs <- fmt.Errorf("fail to write to output file: %v", err):
-					default:
-					}
-					cancel()
-					return
-				}
-			}
-		}()
+	for i, b := range prot {
+		pos := startPos + 3*i
+		if pos+2 >= len(lower) {
+			break
+		}
+		if b >= 'A' && b <= 'Z' && b != unknown && lower[pos] && lower[pos+1] && lower[pos+2] {
+			prot[i] = b + 'a' - 'A'
+		}
 	}
-	readSequenceFromFasta(ctx, inputSequence, fnaSequences)
+}
 
-	wg.Wait()
-	select {
-	case err, ok := <-errs:
-		if ok {
-			return err
+// an open reading frame of a translated frame: prot[start:end] are
+// the AA from the start codon to the stop codon excluded
+type orf struct {
+	start int
+	end   int
+}
+
+// append to orfs the ORFs of prot with at least minLen AA. An ORF starts on
+// the first 'M' after a stop, and ends on the next stop
+func findORFs(orfs []orf, prot []byte, minLen int) []orf {
+
+	start := -1
+	for i, b := range prot {
+		switch {
+		case start == -1 && (b == 'M' || b == 'm'):
+			start = i
+		case start != -1 && b == stopByte:
+			if i-start >= minLen {
+				orfs = append(orfs, orf{start: start, end: i})
+			}
+			start = -1
 		}
-	default:
 	}
-	return nil
+	return orfs
 }
 
-func readSequenceFromFasta(ctx context.Context, inputSequence io.Reader, fnaSequences chan encodedSequence) {
+// returns the positions of the ORF on the forward nucleotide sequence,
+// starting at 1 and including the stop codon. For reverse frames, begin
+// is greater than end
+func (o orf) coordinates(startPos, nuclSeqLength int, reverse bool) (begin, end int) {
 
-	feeder := &fastaChannelFeeder{
-		idBuffer:       bytes.NewBuffer(nil),
-		commentBuffer:  bytes.NewBuffer(nil),
-		sequenceBuffer: bytes.NewBuffer(nil),
-		fastaChan:      fnaSequences,
+	// 0-based positions on the translated strand
+	first := startPos + 3*o.start
+	last := startPos + 3*o.end + 2
+	if last > nuclSeqLength-1 {
+		last = nuclSeqLength - 1
 	}
-	// fasta format is:
-	//
-	// >sequenceID some comments on sequence
-	// ACAGGCAGAGACACGACAGACGACGACACAGGAGCAGACAGCAGCAGACGACCACATATT
-	// TTTGCGGTCACATGACGACTTCGGCAGCGA
-	//
-	// see https://blast.ncbi.nlm.nih.gov/Blast.cgi?CMD=Web&PAGE_TYPE=BlastDocs&DOC_TYPE=BlastHelp
-	// section 1 for details
-	scanner := bufio.NewScanner(inputSequence)
-Loop:
-	for scanner.Scan() {
-
-		line := scanner.Bytes()
-		if len(line) == 0 {
-			continue
-		}
-		if line[0] == '>' {
+	if reverse {
+		return nuclSeqLength - first, nuclSeqLength - last
+	}
+	return first + 1, last + 1
+}
 
-			if feeder.idBuffer.Len() > 0 {
-				select {
-				case <-ctx.Done():
-					break Loop
-				default:
-				}
-				feeder.sendFasta()
-			}
-			feeder.reset()
+// RequestedFrames returns the suffixes of the frames to translate for a
+// -f | --frame value, from 1 to 6 where 4, 5, 6 are frames -1, -2, -3
+func RequestedFrames(frameName string) ([]int, error) {
 
-			// parse the ID of the sequence. ID is formatted like this:
-			// >sequenceID comments
-			seqID := bytes.SplitN(line, []byte{' '}, 2)
-			feeder.idBuffer.Write(seqID[0])
+	frames, _, err := computeFrames(frameName)
+	if err != nil {
+		return nil, err
+	}
 
-			if len(seqID) > 1 {
-				feeder.commentBuffer.WriteByte(' ')
-				feeder.commentBuffer.Write(seqID[1])
-			}
-		} else {
-			// if the line doesn't start with '>', then it's a part of the
-			// nucleotide sequence, so write it to the buffer
-			feeder.sequenceBuffer.Write(line)
+	var requested []int
+	for frameIndex, generate := range frames {
+		if generate != 0 {
+			requested = append(requested, frameIndex+1)
 		}
 	}
-	// don't forget to push last sequence
-	select {
-	case <-ctx.Done():
-	default:
-		feeder.sendFasta()
-	}
-	close(fnaSequences)
+	return requested, nil
 }
 
-// a type to hold an encoded fasta sequence
-//
-//	s[0:4] stores the size of the sequence id + the size of the comment as an uint32 (little endian)
-//  s[4:idSize] stores the sequence id, and the comment id there is one
-//  s[idSize:] stores the nucl sequence
-type encodedSequence []byte
+type writer struct {
+	buf *bytes.Buffer
+	// output format, 'fasta', 'tsv' or 'jsonl'
+	format string
+	// style of the fasta headers, 'default' or 'emboss'
+	headerStyle string
+	// nb of AA per line
+	lineSize int
+	// byte used for stop codons in the output
+	stop byte
+	// bytes used for codons that can't be translated in the output,
+	// and for the incomplete last codon of a frame
+	unknown         byte
+	terminalUnknown byte
+	// write three-letter AA codes instead of one-letter codes
+	threeLetter bool
+	// append the nb of nucleotides to the fasta headers
+	annotateLength bool
+	// note the RNA sequences in the fasta headers
+	rnaOutput bool
+	// nb of records and AA written by the writer
+	recordCount int
+	aaCount     int
+	// nb of each AA written by the writer
+	aminoAcids [256]int
+	// if not nil, records are moved from buf to sorted once
+	// written, see --sort-by-length. sortKey is the position
+	// of the next record
+	sorted  *sortedRecords
+	sortKey sortedRecord
+	// if not nil, the records written are added to it, see --dedup
+	records *[]dedupRecord
+	// buffer for the protein in jsonl format
+	scratch bytes.Buffer
+}
 
-var pool = sync.Pool{
-	New: func() interface{} {
-		return make(encodedSequence, 512)
-	},
+// a translated frame, or an ORF of a translated frame
+type record struct {
+	// id of the sequence, without the leading '>'
+	id []byte
+	// comment of the sequence, may be empty
+	comment []byte
+	// frame of the translation, from '1' to '6'
+	frame byte
+	// suffix added to the id for the frame, see --frame-suffixes
+	suffix string
+	// in ORF mode, nb of the ORF in the frame starting at 1, and
+	// its position on the nucleotide sequence. 0 otherwise. With
+	// --reverse-coords, reverse frames have a position but no ORF
+	orf   int
+	begin int
+	end   int
+	// nb of nucleotides of the translated sequence
+	nuclLength int
+	// the sequence has a 'U'
+	rna bool
+	// the last AA of prot is the translation of an incomplete codon
+	incomplete bool
+	// stop codons must be '*'
+	prot []byte
+	// with --concat-frames, the frame is 0 and the positions
+	// of the frames in prot are like '1:1-20,2:22-41'
+	frameBounds []byte
+	// with --concat-frames, positions in prot of the last AA of
+	// the frames ending with an incomplete codon
+	terminals []int
 }
 
-func getSizedSlice(idSize, requiredSize int) encodedSequence {
-	s := pool.Get().(encodedSequence)
-	binary.LittleEndian.PutUint32(s[0:4], uint32(idSize))
+// append the protein of a frame to the proteins of the previous frames,
+// separated by a stop, and its positions to the positions of the frames.
+// Empty frames are not added
+func concatFrame(concat, bounds []byte, r *record) ([]byte, []byte) {
 
-	for len(s) < requiredSize {
-		s = append(s, byte(0))
+	if len(r.prot) == 0 {
+		return concat, bounds
 	}
-	return s[0:requiredSize]
+	if len(concat) > 0 {
+		concat = append(concat, stopByte)
+		bounds = append(bounds, ',')
+	}
+	start := len(concat) + 1
+	concat = append(concat, r.prot...)
+	bounds = append(bounds, r.frame, ':')
+	bounds = strconv.AppendInt(bounds, int64(start), 10)
+	bounds = append(bounds, '-')
+	bounds = strconv.AppendInt(bounds, int64(len(concat)), 10)
+	return concat, bounds
 }
 
-func (f *fastaChannelFeeder) sendFasta() {
-
-	idSize := 4 + f.idBuffer.Len() + f.commentBuffer.Len()
-	requiredSize := idSize + f.sequenceBuffer.Len()
+// write a record in the output format
+func (w *writer) writeRecord(r *record) {
 
-	s := getSizedSlice(idSize, requiredSize)
+	w.recordCount++
+	w.aaCount += len(r.prot)
+	for _, b := range r.prot {
+		w.aminoAcids[b]++
+	}
+	// copied before the stops and the unknown codons are
+	// replaced by the output characters
+	var protein string
+	if w.records != nil {
+		protein = string(r.prot)
+	}
 
-	if f.commentBuffer.Len() > 0 {
-		copy(s[idSize-f.commentBuffer.Len():idSize], f.commentBuffer.Bytes())
+	start := w.buf.Len()
+	switch w.format {
+	case "tsv":
+		w.writeTSV(r)
+	case "jsonl":
+		w.writeJSON(r)
+	default:
+		w.writeFasta(r)
+	}
+	if w.sorted != nil {
+		w.sortKey.length = len(r.prot)
+		w.sorted.take(w.buf, start, w.sortKey)
+		w.sortKey.n++
 	}
+	if w.records != nil {
+		*w.records = append(*w.records, dedupRecord{
+			bufferSpan: bufferSpan{writer: w.sortKey.writer, start: start, end: w.buf.Len()},
+			protein:    protein,
+		})
+	}
+}
 
-	copy(s[4:4+f.idBuffer.Len()], f.idBuffer.Bytes())
+// a record written with --sort-by-length, and its position
+// in the output without sorting
+type sortedRecord struct {
+	// nb of AA of the record
+	length int
+	// position of the input, of the sequence in the input,
+	// and of the record in the records of the sequence
+	input int
+	index int
+	n     int
+	// writer of the record, and the record in the output format
+	writer int
+	data   []byte
+}
 
-	// convert the sequence of bytes to an array of uint8 codes,
-	// so a codon (3 nucleotides | 3 bytes ) can be represented
-	// as an uint32
-	for i, b := range f.sequenceBuffer.Bytes() {
+// the records of all workers, written once all sequences are translated
+type sortedRecords struct {
+	sync.Mutex
+	records []sortedRecord
+}
 
-		switch b {
-		case 'A':
-			s[i+idSize] = aCode
-		case 'C':
-			s[i+idSize] = cCode
-		case 'G':
-			s[i+idSize] = gCode
-		case 'T', 'U':
-			s[i+idSize] = tCode
-		case 'N':
-			s[i+idSize] = nCode
+// move the record written in buf after start to the records
+func (s *sortedRecords) take(buf *bytes.Buffer, start int, r sortedRecord) {
+
+	r.data = append([]byte(nil), buf.Bytes()[start:]...)
+	buf.Truncate(start)
+
+	s.Lock()
+	s.records = append(s.records, r)
+	s.Unlock()
+}
+
+// write the records to their writers by decreasing length,
+// records of the same length in the input order
+func (s *sortedRecords) writeTo(writers []io.Writer) error {
+
+	sort.Slice(s.records, func(i, j int) bool {
+		a, b := s.records[i], s.records[j]
+		switch {
+		case a.length != b.length:
+			return a.length > b.length
+		case a.input != b.input:
+			return a.input < b.input
+		case a.index != b.index:
+			return a.index < b.index
 		default:
-			fmt.Printf("WARNING: invalid char in sequence %s: %s, ignoring", s[4:4+idSize], string(b))
+			return a.n < b.n
+		}
+	})
+
+	bufs := make([]*bufio.Writer, len(writers))
+	for _, r := range s.records {
+		if bufs[r.writer] == nil {
+			bufs[r.writer] = bufio.NewWriter(writers[r.writer])
+		}
+		if _, err := bufs[r.writer].Write(r.data); err != nil {
+			return fmt.Errorf("fail to write to output file: %v", err)
+		}
+	}
+	for _, buf := range bufs {
+		if buf == nil {
+			continue
+		}
+		if err := buf.Flush(); err != nil {
+			return fmt.Errorf("fail to write to output file: %v", err)
 		}
 	}
-	f.fastaChan <- s
+	return nil
 }
 
-type fastaChannelFeeder struct {
-	idBuffer       *bytes.Buffer
-	commentBuffer  *bytes.Buffer
-	sequenceBuffer *bytes.Buffer
-	fastaChan      chan encodedSequence
+// returns the suffixes of the ids for each frame, from a comma-separated
+// list like '1,2,3,r1,r2,r3', or the default suffixes if value is empty
+func parseFrameSuffixes(value string) ([]string, error) {
+
+	if value == "" {
+		frameSuffixes := make([]string, len(suffixes))
+		for i := range suffixes {
+			frameSuffixes[i] = suffixes[i : i+1]
+		}
+		return frameSuffixes, nil
+	}
+	frameSuffixes := strings.Split(value, ",")
+	if len(frameSuffixes) != len(suffixes) {
+		return nil, fmt.Errorf("wrong value for --frame-suffixes parameter: '%s', must be %d suffixes separated by commas", value, len(suffixes))
+	}
+	for _, suffix := range frameSuffixes {
+		if suffix == "" {
+			return nil, fmt.Errorf("wrong value for --frame-suffixes parameter: '%s', suffixes can't be empty", value)
+		}
+	}
+	return frameSuffixes, nil
 }
 
-func (f *fastaChannelFeeder) reset() {
-	f.idBuffer.Reset()
-	f.sequenceBuffer.Reset()
-	f.commentBuffer.Reset()
+// write a record as a header line like '>id_<frame> comment', then the
+// protein with lineSize AA per line. In ORF mode, the header looks like
+// '>id_<frame>_<n> [begin - end] comment'
+func (w *writer) writeFasta(r *record) {
+
+	w.buf.WriteByte('>')
+	w.buf.Write(r.id)
+	if r.frame != 0 {
+		w.buf.WriteByte('_')
+		w.buf.WriteString(r.suffix)
+	}
+	if r.orf > 0 {
+		fmt.Fprintf(w.buf, "_%d [%d - %d]", r.orf, r.begin, r.end)
+	} else if r.begin > 0 {
+		fmt.Fprintf(w.buf, " [%d - %d]", r.begin, r.end)
+	}
+	if len(r.frameBounds) > 0 {
+		w.buf.WriteString(" frames=")
+		w.buf.Write(r.frameBounds)
+	}
+	if len(r.comment) > 0 {
+		w.buf.WriteByte(' ')
+		w.buf.Write(r.comment)
+	}
+	if w.annotateLength {
+		fmt.Fprintf(w.buf, " len=%d", r.nuclLength)
+	}
+	if w.rnaOutput && r.rna {
+		w.buf.WriteString(" molecule=RNA")
+	}
+	if w.headerStyle == "emboss" && r.frame >= suffixes[3] {
+		w.buf.WriteString(" (REVERSE SENSE)")
+	}
+	w.buf.WriteByte('\n')
+
+	prot := r.prot
+	if len(prot) == 0 {
+		return
+	}
+
+	if w.threeLetter {
+		for i, b := range prot {
+			lineStart := i%w.lineSize == 0
+			if lineStart && i > 0 {
+				w.buf.WriteByte('\n')
+			}
+			w.writeThreeLetter(w.buf, b, lineStart)
+		}
+		w.buf.WriteByte('\n')
+		return
+	}
+
+	w.replaceCodes(prot, r.incomplete, r.terminals)
+	for len(prot) > w.lineSize {
+		w.buf.Write(prot[:w.lineSize])
+		w.buf.WriteByte('\n')
+		prot = prot[w.lineSize:]
+	}
+	w.buf.Write(prot)
+	w.buf.WriteByte('\n')
+}
+
+// columns of the tsv format
+const tsvHeaderLine = "id\tframe\tlength\tprotein\n"
+
+// returns true if w is a regular file that isn't empty, like a file
+// appended to. The tsv header is then already in the file
+func hasContent(w io.Writer) bool {
+
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	info, err := f.Stat()
+	return err == nil && info.Mode().IsRegular() && info.Size() > 0
+}
+
+// write a record as a single line with the sequence id, the
+// frame, the nb of AA and the protein, separated by tabs
+func (w *writer) writeTSV(r *record) {
+
+	w.buf.Write(r.id)
+	w.buf.WriteByte('\t')
+	w.buf.WriteByte(r.frame)
+	w.buf.WriteByte('\t')
+	w.buf.WriteString(strconv.Itoa(len(r.prot)))
+	w.buf.WriteByte('\t')
+	w.writeProtein(w.buf, r.prot, r.incomplete)
+	w.buf.WriteByte('\n')
+}
+
+// jsonl format, one object per record
+type jsonRecord struct {
+	ID      string `json:"id"`
+	Frame   int    `json:"frame"`
+	Comment string `json:"comment"`
+	Protein string `json:"protein"`
+	// only in ORF mode
+	ORF   int `json:"orf,omitempty"`
+	Begin int `json:"begin,omitempty"`
+	End   int `json:"end,omitempty"`
+}
+
+// write a record as a json object on a single line
+func (w *writer) writeJSON(r *record) {
+
+	w.scratch.Reset()
+	w.writeProtein(&w.scratch, r.prot, r.incomplete)
+
+	json.NewEncoder(w.buf).Encode(jsonRecord{
+		ID:      string(r.id),
+		Frame:   int(r.frame - '0'),
+		Comment: string(r.comment),
+		Protein: w.scratch.String(),
+		ORF:     r.orf,
+		Begin:   r.begin,
+		End:     r.end,
+	})
+}
+
+// write a protein on a single line
+func (w *writer) writeProtein(buf *bytes.Buffer, prot []byte, incomplete bool) {
+
+	if w.threeLetter {
+		for i, b := range prot {
+			w.writeThreeLetter(buf, b, i == 0)
+		}
+		return
+	}
+	w.replaceCodes(prot, incomplete, nil)
+	buf.Write(prot)
+}
+
+// replace the '*' and 'X' of the protein by the stop and unknown
+// bytes of the output. If incomplete is set, a 'X' at the end of
+// the protein is replaced by the terminal unknown byte, like a 'X'
+// at one of the positions of terminals
+func (w *writer) replaceCodes(prot []byte, incomplete bool, terminals []int) {
+
+	if w.stop == stopByte && w.unknown == unknown && w.terminalUnknown == unknown {
+		return
+	}
+	// the terminal 'X' are marked by a 0 before the replacement,
+	// as the stop byte may also be 'X'
+	if last := len(prot) - 1; incomplete && last >= 0 && prot[last] == unknown {
+		prot[last] = 0
+	}
+	for _, i := range terminals {
+		if prot[i] == unknown {
+			prot[i] = 0
+		}
+	}
+	for i, b := range prot {
+		switch b {
+		case stopByte:
+			prot[i] = w.stop
+		case unknown:
+			prot[i] = w.unknown
+		case 0:
+			prot[i] = w.terminalUnknown
+		}
+	}
+}
+
+// write the three-letter code of an AA. AA of a line are separated by a space
+func (w *writer) writeThreeLetter(buf *bytes.Buffer, b byte, lineStart bool) {
+
+	if !lineStart {
+		buf.WriteByte(' ')
+	}
+	// AA of soft-masked codons are lowercase, see --preserve-case
+	lower := b >= 'a' && b <= 'z'
+	if lower {
+		b -= 'a' - 'A'
+	}
+	code, ok := threeLetterCodes[b]
+	switch {
+	case b == stopByte && w.stop != unknown:
+		code = "Stop"
+	case !ok:
+		code = threeLetterCodes[unknown]
+	}
+	if lower {
+		code = strings.ToLower(code)
+	}
+	buf.WriteString(code)
+}
+
+var threeLetterCodes = map[byte]string{
+	'A': "Ala",
+	'R': "Arg",
+	'N': "Asn",
+	'D': "Asp",
+	'C': "Cys",
+	'Q': "Gln",
+	'E': "Glu",
+	'G': "Gly",
+	'H': "His",
+	'I': "Ile",
+	'L': "Leu",
+	'K': "Lys",
+	'M': "Met",
+	'F': "Phe",
+	'P': "Pro",
+	'S': "Ser",
+	'T': "Thr",
+	'W': "Trp",
+	'Y': "Tyr",
+	'V': "Val",
+	'U': "Sec",
+	'O': "Pyl",
+	'B': "Asx",
+	'Z': "Glx",
+	'J': "Xle",
+	'X': "Xaa",
+	'-': "---",
+}
+
+const (
+	// default size of the buffer for writing to file
+	maxBufferSize = 1024 * 1024 * 30
+	// default nb of AA per line, see --line-width
+	maxLineSize = 60
+	// suffixes ta add to sequence id for each frame
+	suffixes = "123456"
+	// max line size for input file. Whole genomes can be stored
+	// on a single line, so this has to be large
+	maxInputLineSize = 1024 * 1024 * 1024
+)
+
+// an input to read sequences from. It's opened only
+// when it's about to be read
+type input struct {
+	name string
+	// ctx stops the download of a URL
+	open func(ctx context.Context) (io.ReadCloser, error)
+}
+
+// Translate read a fata file, translate each sequence to the corresponding prot sequence in the specified frame.
+// It's the same as TranslateStream
+func Translate(inputSequence io.Reader, out io.Writer, options Options) error {
+	return TranslateStream(inputSequence, out, options)
+}
+
+// TranslateStream read fasta sequences from r, and write their translation to w. r
+// and w can be any reader and writer, they are not closed
+func TranslateStream(inputSequence io.Reader, out io.Writer, options Options) error {
+
+	_, err := translate([]input{streamInput(inputSequence)}, sameWriter(out), options)
+	return err
+}
+
+// returns an input reading r, which is not closed
+func streamInput(r io.Reader) input {
+	return input{
+		name: "input sequence",
+		open: func(ctx context.Context) (io.ReadCloser, error) {
+			return ioutil.NopCloser(r), nil
+		},
+	}
+}
+
+// FastaSequence is a sequence read by ReadFasta
+type FastaSequence struct {
+	ID string
+	// comment of the header, after the id, empty if none
+	Comment string
+	// nucleotides of the sequence, encoded like the translated
+	// sequences: 0 for 'N', 1 for 'A', 2 for 'C', 3 for 'T' or 'U',
+	// 4 for 'G' and 5 for a gap. Ambiguous nucleotides are 'N'
+	Sequence []byte
+}
+
+// ReadFasta read fasta sequences from r, and send them to the returned channel
+// without translating them. The channel is closed once all sequences are read,
+// or on the first error, which is then sent to the error channel. The sequence
+// channel has to be read until it's closed. r is not closed
+func ReadFasta(r io.Reader) (<-chan FastaSequence, <-chan error) {
+
+	sequences := make(chan FastaSequence)
+	errs := make(chan error, 1)
+
+	// sequences are read one at a time, as with a single worker
+	options := Options{Optional: Optional{NumWorker: 1}}
+	queueDepth, err := computeQueueDepth(options)
+	if err != nil {
+		errs <- err
+		close(sequences)
+		close(errs)
+		return sequences, errs
+	}
+	fnaSequences := make(chan indexedSequence, queueDepth)
+	feeder, err := newFastaChannelFeeder(fnaSequences, cap(fnaSequences), options)
+	if err != nil {
+		errs <- err
+		close(sequences)
+		close(errs)
+		return sequences, errs
+	}
+
+	go func() {
+		defer close(errs)
+
+		var readErr error
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			_, readErr = readInputs(context.Background(), []input{streamInput(r)}, feeder, 1)
+		}()
+
+		for indexed := range fnaSequences {
+			if indexed.sequence != nil {
+				sequences <- newFastaSequence(*indexed.sequence)
+				pool.Put(indexed.sequence)
+			}
+			<-indexed.inFlight
+		}
+		<-done
+		close(sequences)
+		if readErr != nil {
+			errs <- readErr
+		}
+	}()
+	return sequences, errs
+}
+
+// returns the id and the comment of an encoded sequence, stored like
+// '>sequenceID comment' after the size of the header, and the position
+// of its first nucleotide. The id is empty if the sequence has no header
+func splitHeader(sequence encodedSequence) (id, comment []byte, idSize int) {
+
+	idSize = int(binary.LittleEndian.Uint32(sequence[0:4]))
+	if idSize <= 4 {
+		return nil, nil, 4
+	}
+	id = sequence[5:idSize]
+	if idEnd := bytes.IndexByte(id, ' '); idEnd != -1 {
+		id, comment = id[:idEnd], id[idEnd+1:]
+	}
+	return id, comment, idSize
+}
+
+// returns a copy of the id, the comment and the nucleotides
+// of an encoded sequence
+func newFastaSequence(sequence encodedSequence) FastaSequence {
+
+	id, comment, idSize := splitHeader(sequence)
+	nucleotides := append([]byte(nil), sequence[idSize:]...)
+	for i, c := range nucleotides {
+		if c == ambiguousCode {
+			nucleotides[i] = nCode
+		}
+	}
+	return FastaSequence{
+		ID:       string(id),
+		Comment:  string(comment),
+		Sequence: nucleotides,
+	}
+}
+
+// Summary holds statistics about a translation
+type Summary struct {
+	// nb of sequences read
+	Sequences int64
+	// nb of records written, ie nb of translated frames,
+	// or nb of ORFs in ORF mode
+	Frames int64
+	// nb of AA written
+	AminoAcids int64
+	// nb of nucleotides translated, in the region if any
+	Nucleotides int64
+	// nb of complete codons translated to 'X' because
+	// they contain an unknown nucleotide 'N'
+	UnknownCodons int64
+	// nb of complete codons translated to 'X' because they
+	// contain an IUPAC ambiguity code, like 'R', but no 'N'
+	AmbiguousCodons int64
+	// nb of incomplete codons at the end of a frame translated
+	// to 'X', because their AA can't be guessed
+	IncompleteCodons int64
+	// nb of records not written with --dedup, because
+	// the same protein was already written
+	Duplicates int64
+	// distinct AA written, sorted. Stop codons are '*' and
+	// codons that can't be translated are 'X', whatever the
+	// output characters
+	Alphabet string
+	// time spent to read, translate and write the sequences
+	Elapsed time.Duration
+}
+
+// Progress holds counters updated while sequences are read. It's safe
+// to read them during the translation
+type Progress struct {
+	sequences int64
+	bytesRead int64
+}
+
+// Sequences returns the nb of sequences read so far
+func (p *Progress) Sequences() int64 {
+	return atomic.LoadInt64(&p.sequences)
+}
+
+// BytesRead returns the nb of bytes of the input read so far
+func (p *Progress) BytesRead() int64 {
+	return atomic.LoadInt64(&p.bytesRead)
+}
+
+// a reader counting the bytes read in a Progress
+type progressReader struct {
+	r        io.Reader
+	progress *Progress
+}
+
+func (p *progressReader) Read(b []byte) (int, error) {
+	n, err := p.r.Read(b)
+	atomic.AddInt64(&p.progress.bytesRead, int64(n))
+	return n, err
+}
+
+// TranslateFiles read fasta files, up to options.NumWorker files at the same time,
+// and write the translation of the sequences of all files to out, in the order
+// of the files
+func TranslateFiles(filenames []string, out io.Writer, options Options) (Summary, error) {
+	return translate(fileInputs(filenames), sameWriter(out), options)
+}
+
+// ValidateFiles read fasta files like TranslateFiles, but doesn't translate
+// the sequences. It returns an error on the first invalid character,
+// duplicate sequence id or empty sequence
+func ValidateFiles(filenames []string, options Options) (Summary, error) {
+
+	start := time.Now()
+
+	queueDepth, err := computeQueueDepth(options)
+	if err != nil {
+		return Summary{}, err
+	}
+	fnaSequences := make(chan indexedSequence, queueDepth)
+
+	options.CheckIDs = true
+	options.RejectEmpty = true
+	feeder, err := newFastaChannelFeeder(fnaSequences, cap(fnaSequences), options)
+	if err != nil {
+		return Summary{}, err
+	}
+	feeder.strict = true
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for indexed := range fnaSequences {
+			if indexed.sequence != nil {
+				pool.Put(indexed.sequence)
+			}
+			<-indexed.inFlight
+		}
+	}()
+
+	nbSequences, err := readInputs(parentContext(options), fileInputs(filenames), feeder, options.NumWorker)
+	<-done
+	if isInterruption(err) {
+		err = ErrInterrupted
+	}
+
+	return Summary{Sequences: nbSequences, Elapsed: time.Since(start)}, err
+}
+
+// TranslateFilesSplit works like TranslateFiles, but write each frame to its own
+// writer: outs[i] receives the translation of the frame with suffix i+1, ie frame
+// -1 is written to outs[3]. Writers of frames that are not translated can be nil,
+// and a writer can receive several frames
+func TranslateFilesSplit(filenames []string, outs []io.Writer, options Options) (Summary, error) {
+
+	if len(outs) != len(suffixes) {
+		return Summary{}, fmt.Errorf("expected %d output writers, got %d", len(suffixes), len(outs))
+	}
+	return translate(fileInputs(filenames), outs, options)
+}
+
+// StdinName is the filename to use to read sequences from stdin
+const StdinName = "-"
+
+func fileInputs(filenames []string) []input {
+
+	inputs := make([]input, 0, len(filenames))
+	for _, filename := range filenames {
+		filename := filename
+		inputs = append(inputs, input{
+			name: filename,
+			open: func(ctx context.Context) (io.ReadCloser, error) {
+				switch {
+				case filename == StdinName:
+					return ioutil.NopCloser(os.Stdin), nil
+				case IsURL(filename):
+					return openURL(ctx, filename)
+				}
+				return os.Open(filename)
+			},
+		})
+	}
+	return inputs
+}
+
+// IsURL returns true if an input name is a URL, like 'https://host/file.fna',
+// rather than a file name. Only http and https URLs can be read
+func IsURL(name string) bool {
+	return strings.Contains(name, "://")
+}
+
+// returns the body of the response to a GET request on the URL. The
+// body is streamed, so the sequences are translated while downloaded.
+// The request and the download are stopped once ctx is cancelled
+func openURL(ctx context.Context, rawURL string) (io.ReadCloser, error) {
+
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("can't read %s: unsupported URL scheme '%s', only http and https URLs can be read", rawURL, u.Scheme)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("fail to download %s: server returned %s", rawURL, resp.Status)
+	}
+	return resp.Body, nil
+}
+
+// translate the sequences to a buffer per frame, and write the buffers
+// to the output writers of the frames once all sequences are translated
+func translateGroupedByFrame(inputs []input, outs []io.Writer, options Options) (Summary, error) {
+
+	frameBufs := make([]*bytes.Buffer, len(outs))
+	frameOuts := make([]io.Writer, len(outs))
+	for i, out := range outs {
+		if out != nil {
+			frameBufs[i] = bytes.NewBuffer(nil)
+			frameOuts[i] = frameBufs[i]
+		}
+	}
+
+	tsvHeader := options.Format == "tsv" && options.TSVHeader
+	options.GroupByFrame = false
+	options.TSVHeader = false
+
+	// when interrupted, the frames of the sequences translated
+	// before are still written
+	summary, err := translate(inputs, frameOuts, options)
+	if err != nil && err != ErrInterrupted {
+		return summary, err
+	}
+
+	// the header is written once per output, except to files appended to
+	written := map[io.Writer]bool{}
+	for i, out := range outs {
+		if out == nil {
+			continue
+		}
+		if tsvHeader && !written[out] && !hasContent(out) {
+			written[out] = true
+			if _, err := io.WriteString(out, tsvHeaderLine); err != nil {
+				return summary, fmt.Errorf("fail to write to output file: %v", err)
+			}
+		}
+		if _, err := out.Write(frameBufs[i].Bytes()); err != nil {
+			return summary, fmt.Errorf("fail to write to output file: %v", err)
+		}
+	}
+	return summary, err
+}
+
+// returns the output writers of each frame when all frames are written to out
+func sameWriter(out io.Writer) []io.Writer {
+
+	outs := make([]io.Writer, len(suffixes))
+	for i := range outs {
+		outs[i] = out
+	}
+	return outs
+}
+
+// group the writers of each frame: returns the distinct writers, and for each
+// frame the index of its writer in writers
+func groupWriters(outs []io.Writer) (writers []io.Writer, frameWriter []int) {
+
+	frameWriter = make([]int, len(outs))
+Loop:
+	for frame, out := range outs {
+		for i, w := range writers {
+			if w == out {
+				frameWriter[frame] = i
+				continue Loop
+			}
+		}
+		frameWriter[frame] = len(writers)
+		writers = append(writers, out)
+	}
+	return writers, frameWriter
+}
+
+func translate(inputs []input, outs []io.Writer, options Options) (summary Summary, err error) {
+
+	if options.GroupByFrame {
+		if options.ConcatFrames {
+			return summary, fmt.Errorf("--concat-frames can't be used with --group-by-frame")
+		}
+		return translateGroupedByFrame(inputs, outs, options)
+	}
+
+	start := time.Now()
+
+	stop, err := computeChar("stopchar", options.StopChar, stopByte)
+	if err != nil {
+		return summary, err
+	}
+	unknownChar, err := computeChar("unknown-char", options.UnknownChar, unknown)
+	if err != nil {
+		return summary, err
+	}
+	terminalUnknown, err := computeChar("terminal-unknown", options.TerminalUnknown, unknownChar)
+	if err != nil {
+		return summary, err
+	}
+	unknownChar, err = computeChar("internal-unknown", options.InternalUnknown, unknownChar)
+	if err != nil {
+		return summary, err
+	}
+	// 0 if internal stops are kept
+	internalStop, err := computeChar("replace-internal-stops", options.ReplaceInternal, 0)
+	if err != nil {
+		return summary, err
+	}
+
+	if options.TableName != "" {
+		options.Table, err = ncbicode.TableCodeByName(options.TableName)
+		if err != nil {
+			return summary, fmt.Errorf("%v, see --list-tables for the supported names", err)
+		}
+	}
+
+	codeMap, err := loadCodeMap(options)
+	if err != nil {
+		return summary, err
+	}
+	arrayCode := createArrayCode(codeMap)
+	// if clean is specified, we want to replace all '*' by 'X' in the output
+	if options.Clean {
+		stop = unknown
+	}
+
+	framesToGenerate, reverse, err := computeFrames(options.Frame)
+	if err != nil {
+		return summary, err
+	}
+
+	var startArrayCode []byte
+	// a table file has no start codons, and the ones of -t | --table
+	// may not match its code
+	if options.AlternativeStart && options.TableFile != "" {
+		return summary, fmt.Errorf("--alternative-start can't be used with --table-file, as the table file has no start codons")
+	}
+	if options.AlternativeStart {
+		startArrayCode, err = createStartArrayCode(options.Table)
+		if err != nil {
+			return summary, err
+		}
+	}
+
+	for frameIndex, generate := range framesToGenerate {
+		// any frame may be requested by a header tag
+		if (generate != 0 || options.FrameFromHeader) && outs[frameIndex] == nil {
+			if options.FrameFromHeader {
+				return summary, fmt.Errorf("--frame-from-header needs an output writer for all frames, no writer for frame %c", suffixes[frameIndex])
+			}
+			return summary, fmt.Errorf("no output writer for frame %c", suffixes[frameIndex])
+		}
+	}
+	// nb of AA per line. By default in three-letter mode,
+	// a line holds the AA of maxLineSize nucleotides
+	lineSize := options.LineWidth
+	switch {
+	case lineSize < 0:
+		return summary, fmt.Errorf("wrong value for --line-width parameter: %d, must be positive", lineSize)
+	case lineSize == 0 && options.ThreeLetter:
+		lineSize = (maxLineSize + 2) / 3
+	case lineSize == 0:
+		lineSize = maxLineSize
+	}
+	frameSuffixes, err := parseFrameSuffixes(options.FrameSuffixes)
+	if err != nil {
+		return summary, err
+	}
+
+	if options.ORF > 0 && options.Format == "tsv" {
+		return summary, fmt.Errorf("--orf can't be used with the tsv format")
+	}
+	if options.BED != nil && options.ORF == 0 {
+		return summary, fmt.Errorf("--bed can only be used with --orf")
+	}
+	if options.GFF != nil && options.ORF == 0 {
+		return summary, fmt.Errorf("--gff can only be used with --orf")
+	}
+	// the stats have a column per frame of -f | --frame, whatever
+	// the frames of the header tags
+	if options.Stats != nil && options.FrameFromHeader {
+		return summary, fmt.Errorf("--stats can't be used with --frame-from-header")
+	}
+	if options.ConcatFrames && (options.ORF > 0 || options.Format == "tsv" || options.Format == "jsonl") {
+		return summary, fmt.Errorf("--concat-frames can only be used with the fasta format, without --orf")
+	}
+
+	// frames sharing the same writer share the same buffer,
+	// so all frames of a sequence are written together
+	writers, frameWriter := groupWriters(outs)
+	if options.ConcatFrames {
+		for frameIndex := range outs {
+			if outs[frameIndex] != nil && frameWriter[frameIndex] != frameWriter[0] {
+				return summary, fmt.Errorf("--concat-frames needs the same output writer for all frames")
+			}
+		}
+	}
+
+	if options.MinProteinLen < 0 {
+		return summary, fmt.Errorf("wrong value for --min-protein-len parameter: %d, must be positive", options.MinProteinLen)
+	}
+	if options.MaskLowComplex < 0 {
+		return summary, fmt.Errorf("wrong value for --mask-lowcomplexity parameter: %d, must be positive", options.MaskLowComplex)
+	}
+
+	if options.Timeout < 0 {
+		return summary, fmt.Errorf("wrong value for --timeout parameter: %v, must be positive", options.Timeout)
+	}
+
+	flushBytes := options.FlushBytes
+	switch {
+	case flushBytes < 0:
+		return summary, fmt.Errorf("wrong value for --flush-bytes parameter: %d, must be positive", flushBytes)
+	case flushBytes == 0:
+		flushBytes = maxBufferSize
+	}
+
+	var memory *memoryGuard
+	if options.MaxMemory != "" {
+		limit, err := parseSize("max-memory", options.MaxMemory)
+		if err != nil {
+			return summary, err
+		}
+		memory = &memoryGuard{limit: limit, value: options.MaxMemory}
+	}
+
+	queueDepth, err := computeQueueDepth(options)
+	if err != nil {
+		return summary, err
+	}
+
+	if options.Format == "tsv" && options.TSVHeader {
+		for _, w := range writers {
+			// writers of frames not translated are nil
+			if w == nil || hasContent(w) {
+				continue
+			}
+			if _, err := io.WriteString(w, tsvHeaderLine); err != nil {
+				return summary, fmt.Errorf("fail to write to output file: %v", err)
+			}
+		}
+	}
+
+	// counts of each codon in frame 1, see countCodons
+	var codonUsage [64]int64
+	// nb of each AA written by all workers, see
+	// Summary.Alphabet and --composition
+	var aminoAcids [256]int64
+
+	var sorted *sortedRecords
+	if options.SortByLength {
+		sorted = &sortedRecords{}
+	}
+
+	// the records are deduplicated in the input order by writeInOrder,
+	// which moves the records kept to sorted
+	var dedup *dedupSet
+	if options.Dedup {
+		dedup = &dedupSet{seen: map[string]int{}, fasta: options.Format != "tsv" && options.Format != "jsonl", sorted: sorted}
+	}
+	workerSorted := sorted
+	if dedup != nil {
+		workerSorted = nil
+	}
+
+	// the stats are written in order like the translations,
+	// as an additional writer
+	statsWriter := -1
+	if options.Stats != nil {
+		statsHeader := "id\tlength\tgc"
+		for frameIndex, generate := range framesToGenerate {
+			if generate != 0 {
+				statsHeader += "\tstops_" + string(suffixes[frameIndex])
+			}
+		}
+		if _, err := io.WriteString(options.Stats, statsHeader+"\n"); err != nil {
+			return summary, fmt.Errorf("fail to write stats: %v", err)
+		}
+		statsWriter = len(writers)
+		writers = append(writers, options.Stats)
+	}
+	// same for the ORF positions
+	bedWriter := -1
+	if options.BED != nil {
+		bedWriter = len(writers)
+		writers = append(writers, options.BED)
+	}
+	gffWriter := -1
+	if options.GFF != nil {
+		if _, err := io.WriteString(options.GFF, gffHeader); err != nil {
+			return summary, fmt.Errorf("fail to write GFF: %v", err)
+		}
+		gffWriter = len(writers)
+		writers = append(writers, options.GFF)
+	}
+
+	fnaSequences := make(chan indexedSequence, queueDepth)
+	translated := make(chan *translatedSequence, queueDepth)
+	// max number of sequences of an input read but not written yet. Sequences
+	// are written in the input order, so this bounds the number of translations
+	// kept in memory while a long sequence is being translated
+	maxInFlight := cap(fnaSequences) + cap(translated) + 2*options.NumWorker
+
+	feeder, err := newFastaChannelFeeder(fnaSequences, maxInFlight, options)
+	if err != nil {
+		return summary, err
+	}
+	feeder.memory = memory
+
+	translatedPool := &sync.Pool{
+		New: func() interface{} {
+			t := &translatedSequence{
+				bufs: make([]*bytes.Buffer, len(writers)),
+			}
+			for i := range t.bufs {
+				t.bufs[i] = bytes.NewBuffer(nil)
+			}
+			return t
+		},
+	}
+
+	parent := parentContext(options)
+	// cancel also stops the translation before the timeout
+	ctx, cancel := context.WithCancel(parent)
+	defer cancel()
+	if options.Timeout > 0 {
+		var cancelTimeout context.CancelFunc
+		ctx, cancelTimeout = context.WithTimeout(ctx, options.Timeout)
+		defer cancelTimeout()
+	}
+
+	collectErr := make(chan error, 1)
+	go func() {
+		collectErr <- writeInOrder(translated, writers, feeder.warnings, flushBytes, memory, translatedPool, dedup, cancel)
+	}()
+
+	// nb of sequences not translated once the context is cancelled
+	var dropped int64
+
+	var wg sync.WaitGroup
+	wg.Add(options.NumWorker)
+
+	for nWorker := 0; nWorker < options.NumWorker; nWorker++ {
+
+		go func() {
+
+			defer wg.Done()
+
+			w := &writer{
+				format:      options.Format,
+				headerStyle: options.HeaderStyle,
+				lineSize:    lineSize,
+				stop:        stop,
+				unknown:     unknownChar,
+				threeLetter: options.ThreeLetter,
+				sorted:      workerSorted,
+
+				terminalUnknown: terminalUnknown,
+				annotateLength:  options.AnnotateLength,
+				rnaOutput:       options.RNAOutput,
+			}
+			var totalUnknown unknownCodons
+			var codonCounts [64]int
+			defer func() {
+				atomic.AddInt64(&summary.Frames, int64(w.recordCount))
+				atomic.AddInt64(&summary.AminoAcids, int64(w.aaCount))
+				atomic.AddInt64(&summary.UnknownCodons, int64(totalUnknown.n))
+				atomic.AddInt64(&summary.AmbiguousCodons, int64(totalUnknown.ambiguous))
+				atomic.AddInt64(&summary.IncompleteCodons, int64(totalUnknown.incomplete))
+				for b, n := range w.aminoAcids {
+					if n > 0 {
+						atomic.AddInt64(&aminoAcids[b], int64(n))
+					}
+				}
+				for i, n := range codonCounts {
+					if n > 0 {
+						atomic.AddInt64(&codonUsage[i], int64(n))
+					}
+				}
+			}()
+
+			// buffers reused for each frame
+			var (
+				prot []byte
+				orfs []orf
+				rec  record
+				// soft-masked positions of the sequence, see --preserve-case
+				lower []bool
+				// frames of the sequence and their positions, see --concat-frames
+				concat          []byte
+				concatBounds    []byte
+				concatTerminals []int
+				// nb of stop codons of each frame
+				stops [6]int
+			)
+
+			for indexed := range fnaSequences {
+
+				// keep reading the channel on cancellation, so the
+				// reader is never stuck on a send
+				select {
+				case <-ctx.Done():
+					if indexed.sequence != nil {
+						memory.addSequence(-len(*indexed.sequence))
+						pool.Put(indexed.sequence)
+					}
+					atomic.AddInt64(&dropped, 1)
+					continue
+				default:
+				}
+
+				t := translatedPool.Get().(*translatedSequence)
+				t.input, t.index, t.inFlight = indexed.input, indexed.index, indexed.inFlight
+				t.end = indexed.sequence == nil
+				if t.end {
+					translated <- t
+					continue
+				}
+				t.records = t.records[:0]
+				if dedup != nil {
+					w.records = &t.records
+				}
+
+				sequence := *indexed.sequence
+				// nb of codons translated to 'X' in all frames of the sequence
+				var sequenceUnknown unknownCodons
+
+				id, comment, idSize := splitHeader(sequence)
+				if options.PreserveCase {
+					lower = softMaskedPositions(lower[:0], sequence[idSize:])
+				}
+				nuclSequence := sequence[idSize:]
+				nuclSeqLength := len(nuclSequence)
+				// soft-masked positions of nuclSequence
+				nuclLower := lower
+				if options.Circular && nuclSeqLength > 0 {
+					// skip the wrapped nucleotides before the sequence,
+					// see sendFasta
+					nuclSequence = sequence[idSize+2:]
+					nuclSeqLength -= 4
+					if options.PreserveCase {
+						nuclLower = lower[2:]
+					}
+				}
+
+				rec.id, rec.comment = id, comment
+				rec.nuclLength, rec.rna = nuclSeqLength, indexed.rna
+
+				startPositions := frameStartPositions(nuclSeqLength, options.Alternative)
+				if options.CodonUsage != nil {
+					countCodons(&codonCounts, nuclSequence[:nuclSeqLength], startPositions[0])
+				}
+
+				// frames of the header tag, if any
+				seqFrames, seqReverse := framesToGenerate, reverse
+				if indexed.frames != nil {
+					seqFrames, seqReverse = indexed.frames, indexed.reverse
+				}
+				stops = [6]int{}
+				w.sortKey = sortedRecord{input: indexed.input, index: indexed.index}
+				concat, concatBounds, concatTerminals = concat[:0], concatBounds[:0], concatTerminals[:0]
+
+				for frameIndex := range suffixes {
+
+					if frameIndex == 3 {
+						if !seqReverse {
+							break
+						}
+						// translate the reverse frames from the reverse-complemented sequence
+						reverseComplement(sequence[idSize:])
+						if options.PreserveCase {
+							reverseSoftMask(lower)
+						}
+					}
+					if seqFrames[frameIndex] == 0 {
+						continue
+					}
+					w.buf = t.bufs[frameWriter[frameIndex]]
+					w.sortKey.writer = frameWriter[frameIndex]
+					startPos := startPositions[frameIndex]
+
+					var nbUnknown unknownCodons
+					prot, nbUnknown = translateFrame(prot[:0], nuclSequence, startPos, arrayCode, startArrayCode)
+					if options.Circular {
+						// the incomplete codon is removed below
+						nbUnknown.incomplete = 0
+					}
+					sequenceUnknown.add(nbUnknown)
+					if options.ForceStartMet && len(prot) > 0 {
+						prot[0] = 'M'
+					}
+					if options.PreserveCase {
+						lowerSoftMasked(prot, nuclLower, startPos)
+					}
+					if options.Circular {
+						// a circular frame has no incomplete codon: only keep
+						// the codons starting in the sequence
+						prot = prot[:(nuclSeqLength-startPos+2)/3]
+					}
+					if statsWriter >= 0 {
+						stops[frameIndex] = bytes.Count(prot, []byte{stopByte})
+					}
+
+					rec.frame, rec.suffix = suffixes[frameIndex], frameSuffixes[frameIndex]
+					if options.ORF > 0 {
+						rec.incomplete = false
+						orfs = findORFs(orfs[:0], prot, options.ORF)
+						for n, orf := range orfs {
+							if orf.end-orf.start < options.MinProteinLen {
+								continue
+							}
+							rec.orf = n + 1
+							rec.begin, rec.end = orf.coordinates(startPos, nuclSeqLength, frameIndex >= 3)
+							rec.prot = prot[orf.start:orf.end]
+							if options.MaskLowComplex > 0 {
+								maskRepeats(rec.prot, options.MaskLowComplex)
+							}
+							w.writeRecord(&rec)
+							if bedWriter >= 0 {
+								start := t.bufs[bedWriter].Len()
+								writeBED(t.bufs[bedWriter], &rec)
+								t.addToRecord(bedWriter, start)
+							}
+							if gffWriter >= 0 {
+								start := t.bufs[gffWriter].Len()
+								writeGFF(t.bufs[gffWriter], &rec)
+								t.addToRecord(gffWriter, start)
+							}
+						}
+					} else {
+						// the last codon of the frame is incomplete, unless
+						// it's trimmed
+						untrimmed := len(prot)
+						if options.Trim {
+							prot = trimRight(prot)
+						}
+						rec.incomplete = !options.Circular && len(prot) == untrimmed && (nuclSeqLength-startPos)%3 > 0
+						if internalStop != 0 {
+							replaceInternalStops(prot, internalStop, rec.incomplete)
+						}
+						if len(prot) < options.MinProteinLen {
+							continue
+						}
+						rec.begin, rec.end = 0, 0
+						if options.ReverseCoords && frameIndex >= 3 && len(prot) > 0 {
+							// positions of the first and the last codon of the frame
+							rec.begin, rec.end = orf{start: 0, end: len(prot) - 1}.coordinates(startPos, nuclSeqLength, true)
+						}
+						rec.orf = 0
+						rec.prot = prot
+						if options.MaskLowComplex > 0 {
+							maskRepeats(rec.prot, options.MaskLowComplex)
+						}
+						if options.ConcatFrames {
+							concat, concatBounds = concatFrame(concat, concatBounds, &rec)
+							if rec.incomplete && len(rec.prot) > 0 && rec.prot[len(rec.prot)-1] == unknown {
+								concatTerminals = append(concatTerminals, len(concat)-1)
+							}
+							continue
+						}
+						w.writeRecord(&rec)
+					}
+				}
+				if len(concatBounds) > 0 {
+					rec.frame, rec.suffix, rec.incomplete = 0, "", false
+					rec.begin, rec.end = 0, 0
+					rec.prot, rec.frameBounds, rec.terminals = concat, concatBounds, concatTerminals
+					w.writeRecord(&rec)
+					rec.frameBounds, rec.terminals = nil, nil
+				}
+
+				if statsWriter >= 0 {
+					writeStats(t.bufs[statsWriter], rec.id, indexed, nuclSeqLength, framesToGenerate, stops)
+				}
+				if nbUnknown := sequenceUnknown.n + sequenceUnknown.ambiguous; options.WarnAmbiguous && nbUnknown > 0 {
+					fmt.Fprintf(&t.warnings, "WARNING: sequence %s: %d codons with unknown nucleotides translated to %c\n", rec.id, nbUnknown, w.unknown)
+				}
+				totalUnknown.add(sequenceUnknown)
+				// once per sequence, so the workers don't contend on it
+				atomic.AddInt64(&summary.Nucleotides, int64(nuclSeqLength))
+
+				memory.addSequence(-len(*indexed.sequence))
+				pool.Put(indexed.sequence)
+				translated <- t
+			}
+		}()
+	}
+	summary.Sequences, err = readInputs(ctx, inputs, feeder, options.NumWorker)
+	if err != nil {
+		cancel()
+	}
+
+	wg.Wait()
+	close(translated)
+
+	writeErr := <-collectErr
+	if dedup != nil {
+		// the workers counted the records not written
+		summary.Duplicates = int64(dedup.duplicates)
+		summary.Frames -= int64(dedup.duplicates)
+		summary.AminoAcids -= int64(dedup.aaCount)
+		for b, n := range dedup.aminoAcids {
+			aminoAcids[b] -= n
+		}
+	}
+
+	var alphabet []byte
+	for b, n := range aminoAcids {
+		if n > 0 {
+			alphabet = append(alphabet, byte(b))
+		}
+	}
+	summary.Alphabet = string(alphabet)
+	summary.Elapsed = time.Since(start)
+	// a single error is returned, whatever the nb of failures: the
+	// first input error, then the first write error. Otherwise, the
+	// context is only checked if it stopped the translation, as the
+	// timeout could expire once all sequences are written
+	interrupted := isInterruption(err) || atomic.LoadInt64(&dropped) > 0
+	switch {
+	case err != nil && !isInterruption(err):
+		return summary, err
+	case writeErr != nil:
+		return summary, writeErr
+	case interrupted && parent.Err() != nil:
+		// the sequences translated before are still written
+		if sorted != nil {
+			if writeErr = sorted.writeTo(writers); writeErr != nil {
+				return summary, writeErr
+			}
+		}
+		return summary, ErrInterrupted
+	case interrupted && ctx.Err() == context.DeadlineExceeded:
+		return summary, fmt.Errorf("translation timed out after %v", options.Timeout)
+	case interrupted:
+		return summary, ctx.Err()
+	}
+	if writeErr == nil && sorted != nil {
+		writeErr = sorted.writeTo(writers)
+	}
+	if writeErr == nil && options.CodonUsage != nil {
+		writeErr = writeCodonUsage(options.CodonUsage, &codonUsage, codeMap, options.RNAOutput)
+	}
+	if writeErr == nil && options.Composition != nil {
+		writeErr = writeComposition(options.Composition, &aminoAcids)
+	}
+	return summary, writeErr
+}
+
+// AA always written by writeComposition, even if not in the proteins
+const compositionAA = "ACDEFGHIKLMNPQRSTVWY*X"
+
+// write a line per AA with the AA, its nb of occurrences and its frequency,
+// separated by tabs. The 20 standard AA, '*' and 'X' are written first, then
+// the other AA written, like 'U' or '-'
+func writeComposition(out io.Writer, counts *[256]int64) error {
+
+	total := int64(0)
+	for _, n := range counts {
+		total += n
+	}
+	aminoAcids := []byte(compositionAA)
+	for b, n := range counts {
+		if n > 0 && strings.IndexByte(compositionAA, byte(b)) == -1 {
+			aminoAcids = append(aminoAcids, byte(b))
+		}
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("aa\tcount\tfrequency\n")
+	for _, aa := range aminoAcids {
+		frequency := 0.0
+		if total > 0 {
+			frequency = float64(counts[aa]) / float64(total)
+		}
+		fmt.Fprintf(&buf, "%c\t%d\t%.4f\n", aa, counts[aa], frequency)
+	}
+	if _, err := out.Write(buf.Bytes()); err != nil {
+		return fmt.Errorf("fail to write composition: %v", err)
+	}
+	return nil
+}
+
+// position of each nucleotide code in "ACGT", -1 for the
+// codes that are not counted in codon usage
+var codonIndex = [...]int{nCode: -1, aCode: 0, cCode: 1, gCode: 2, tCode: 3, gapCode: -1, ambiguousCode: -1}
+
+// add the codons of a frame to counts. The position of codon
+// 'XYZ' in counts is the position of XYZ in base 4, with
+// A=0, C=1, G=2 and T=3
+func countCodons(counts *[64]int, nuclSequence []byte, startPos int) {
+
+	for pos := startPos; pos+2 < len(nuclSequence); pos += 3 {
+		first, second, third := codonIndex[nuclSequence[pos]], codonIndex[nuclSequence[pos+1]], codonIndex[nuclSequence[pos+2]]
+		if first < 0 || second < 0 || third < 0 {
+			continue
+		}
+		counts[first<<4|second<<2|third]++
+	}
+}
+
+// write a line per codon with the codon, its AA, its nb of
+// occurrences and its frequency, separated by tabs. If rna is
+// set, codons are written with 'U' instead of 'T'
+func writeCodonUsage(out io.Writer, counts *[64]int64, codeMap map[string]byte, rna bool) error {
+
+	total := int64(0)
+	for _, n := range counts {
+		total += n
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("codon\taa\tcount\tfrequency\n")
+	nucleotides := "ACGT"
+	for i, n := range counts {
+		codon := []byte{nucleotides[i>>4], nucleotides[i>>2&3], nucleotides[i&3]}
+		aa := codeMap[string(codon)]
+		if aa == 0 {
+			// custom tables may not define all codons
+			aa = unknown
+		}
+		frequency := 0.0
+		if total > 0 {
+			frequency = float64(n) / float64(total)
+		}
+		if rna {
+			codon = bytes.Replace(codon, []byte{'T'}, []byte{'U'}, -1)
+		}
+		fmt.Fprintf(&buf, "%s\t%c\t%d\t%.4f\n", codon, aa, n, frequency)
+	}
+	if _, err := out.Write(buf.Bytes()); err != nil {
+		return fmt.Errorf("fail to write codon usage: %v", err)
+	}
+	return nil
+}
+
+// write the position of an ORF as a BED line, with the id, the start
+// from 0, the end excluded, the name, the score and the strand
+func writeBED(buf *bytes.Buffer, r *record) {
+
+	start, end, strand := r.begin-1, r.end, '+'
+	if r.frame >= suffixes[3] {
+		start, end, strand = r.end-1, r.begin, '-'
+	}
+	fmt.Fprintf(buf, "%s\t%d\t%d\t%s_%s_%d\t0\t%c\n", r.id, start, end, r.id, r.suffix, r.orf, strand)
+}
+
+// first line of a GFF3 file
+const gffHeader = "##gff-version 3\n"
+
+// write an ORF as a GFF3 CDS feature: the sequence id, the source, the type,
+// the start and the end of the ORF with start <= end, no score, the strand,
+// the phase and the attributes, separated by tabs
+func writeGFF(buf *bytes.Buffer, r *record) {
+
+	start, end, strand := r.begin, r.end, '+'
+	if r.frame >= suffixes[3] {
+		start, end, strand = r.end, r.begin, '-'
+	}
+	// the phase is the nb of nucleotides before the first complete codon,
+	// from the end on the reverse strand. An ORF starts on its first
+	// codon, so it's always 0
+	fmt.Fprintf(buf, "%s\tgotranseq\tCDS\t%d\t%d\t.\t%c\t0\tID=%s_%s_%d\n", r.id, start, end, strand, r.id, r.suffix, r.orf)
+}
+
+// write the id, the nb of nucleotides, the GC content and the nb of stop
+// codons of each translated frame of a sequence, separated by tabs
+func writeStats(buf *bytes.Buffer, id []byte, indexed indexedSequence, nuclSeqLength int, framesToGenerate []int, stops [6]int) {
+
+	// GC content of the A, C, G and T of the sequence
+	gc := 0.0
+	if total := indexed.gcCount + indexed.atCount; total > 0 {
+		gc = 100 * float64(indexed.gcCount) / float64(total)
+	}
+	fmt.Fprintf(buf, "%s\t%d\t%.2f", id, nuclSeqLength, gc)
+	for frameIndex, generate := range framesToGenerate {
+		if generate != 0 {
+			fmt.Fprintf(buf, "\t%d", stops[frameIndex])
+		}
+	}
+	buf.WriteByte('\n')
+}
+
+// the translation of a sequence, with one buffer per output writer
+type translatedSequence struct {
+	// position of the input, and of the sequence in the input
+	input int
+	index int
+	// marks the end of the input, there is no translation
+	end bool
+	// slots of the input, see fastaChannelFeeder
+	inFlight chan struct{}
+	bufs     []*bytes.Buffer
+	// warnings about the sequence, written with the sequence
+	warnings bytes.Buffer
+	// records of the sequence in bufs, only with --dedup
+	records []dedupRecord
+}
+
+// mark the line written to the buffer of writer after start as a part of
+// the last record, so it's not written if the record is a duplicate
+func (t *translatedSequence) addToRecord(writer, start int) {
+
+	if n := len(t.records); n > 0 {
+		r := &t.records[n-1]
+		r.extra = append(r.extra, bufferSpan{writer: writer, start: start, end: t.bufs[writer].Len()})
+	}
+}
+
+// bytes of the buffer of a writer
+type bufferSpan struct {
+	writer int
+	start  int
+	end    int
+}
+
+// a record in the buffers of a translated sequence, see --dedup
+type dedupRecord struct {
+	bufferSpan
+	protein string
+	// lines of the record in other outputs, like --bed
+	extra []bufferSpan
+}
+
+// a record kept with --dedup, and the nb of duplicates not written
+type keptRecord struct {
+	sortedRecord
+	dups int
+}
+
+// the distinct proteins of the translated sequences, in the input order.
+// The records kept are written once all sequences are translated, so
+// their nb of duplicates is known
+type dedupSet struct {
+	// position of the proteins in kept
+	seen map[string]int
+	kept []keptRecord
+	// add 'dups=n' to the headers
+	fasta bool
+	// if not nil, the records kept are moved to sorted instead
+	// of being written, see --sort-by-length
+	sorted *sortedRecords
+	// nb of records, AA, and of each AA not written
+	duplicates int
+	aaCount    int
+	aminoAcids [256]int64
+	// spans to remove from the buffers of a sequence
+	removed [][]bufferSpan
+}
+
+// remove the records of t from its buffers. The records of new proteins
+// are kept, the other ones are counted as duplicates of the kept records
+func (d *dedupSet) filter(t *translatedSequence) {
+
+	if len(d.removed) < len(t.bufs) {
+		d.removed = make([][]bufferSpan, len(t.bufs))
+	}
+	for n, r := range t.records {
+		d.removed[r.writer] = append(d.removed[r.writer], r.bufferSpan)
+		if k, ok := d.seen[r.protein]; ok {
+			d.kept[k].dups++
+			d.duplicates++
+			d.aaCount += len(r.protein)
+			for i := 0; i < len(r.protein); i++ {
+				d.aminoAcids[r.protein[i]]++
+			}
+			for _, e := range r.extra {
+				d.removed[e.writer] = append(d.removed[e.writer], e)
+			}
+			continue
+		}
+		d.seen[r.protein] = len(d.kept)
+		d.kept = append(d.kept, keptRecord{sortedRecord: sortedRecord{
+			length: len(r.protein),
+			input:  t.input,
+			index:  t.index,
+			n:      n,
+			writer: r.writer,
+			data:   append([]byte(nil), t.bufs[r.writer].Bytes()[r.start:r.end]...),
+		}})
+	}
+	// the spans of a buffer are in the order they were written
+	for i, spans := range d.removed {
+		if len(spans) == 0 {
+			continue
+		}
+		data := t.bufs[i].Bytes()
+		size, prev := spans[0].start, spans[0].end
+		for _, span := range spans[1:] {
+			size += copy(data[size:], data[prev:span.start])
+			prev = span.end
+		}
+		size += copy(data[size:], data[prev:])
+		t.bufs[i].Truncate(size)
+		d.removed[i] = spans[:0]
+	}
+}
+
+// write the records kept to their buffers, or move them to sorted
+func (d *dedupSet) writeKept(outBufs []*bytes.Buffer) {
+
+	for _, k := range d.kept {
+		if d.fasta && k.dups > 0 {
+			// the header is the first line of the record
+			end := bytes.IndexByte(k.data, '\n')
+			header := append([]byte(nil), k.data[:end]...)
+			header = append(header, " dups="...)
+			header = strconv.AppendInt(header, int64(k.dups), 10)
+			k.data = append(header, k.data[end:]...)
+		}
+		if d.sorted != nil {
+			d.sorted.records = append(d.sorted.records, k.sortedRecord)
+			continue
+		}
+		outBufs[k.writer].Write(k.data)
+	}
+	d.kept = nil
+}
+
+// nb of bytes of the translations and of the warnings
+func (t *translatedSequence) size() int {
+
+	n := t.warnings.Len()
+	for _, buf := range t.bufs {
+		n += buf.Len()
+	}
+	return n
+}
+
+// write the translated sequences to their writers in the order of the inputs.
+// A slot of the input is released for each sequence written. On write error,
+// the translation is cancelled but the channel is still drained. Buffers are
+// written once they hold more than flushBytes bytes. If dedup is not nil,
+// the records of the sequences are deduplicated and written at the end
+func writeInOrder(translated chan *translatedSequence, writers []io.Writer, warnings io.Writer, flushBytes int, memory *memoryGuard, translatedPool *sync.Pool, dedup *dedupSet, cancel context.CancelFunc) error {
+
+	outBufs := make([]*bytes.Buffer, len(writers))
+	for i := range outBufs {
+		outBufs[i] = bytes.NewBuffer(nil)
+	}
+
+	var err error
+	flush := func(i int) {
+		_, err = writers[i].Write(outBufs[i].Bytes())
+		if err != nil {
+			err = fmt.Errorf("fail to write to output file: %v", err)
+			cancel()
+		}
+		outBufs[i].Reset()
+	}
+
+	// translations received before the translation of previous sequences,
+	// and their size in bytes
+	pending := map[sequenceKey]*translatedSequence{}
+	pendingBytes := 0
+	next := sequenceKey{}
+
+	for t := range translated {
+
+		pending[sequenceKey{input: t.input, index: t.index}] = t
+		pendingBytes += t.size()
+
+		for {
+			t, ok := pending[next]
+			if !ok {
+				break
+			}
+			delete(pending, next)
+			pendingBytes -= t.size()
+			<-t.inFlight
+			if t.end {
+				next = sequenceKey{input: next.input + 1}
+				translatedPool.Put(t)
+				continue
+			}
+			next.index++
+
+			if dedup != nil {
+				dedup.filter(t)
+			}
+			for i, buf := range t.bufs {
+				if err == nil {
+					outBufs[i].Write(buf.Bytes())
+					if outBufs[i].Len() > flushBytes {
+						flush(i)
+					}
+				}
+				buf.Reset()
+			}
+			if t.warnings.Len() > 0 {
+				warnings.Write(t.warnings.Bytes())
+				t.warnings.Reset()
+			}
+			translatedPool.Put(t)
+		}
+
+		if err == nil && memory != nil {
+			buffered := pendingBytes
+			for _, buf := range outBufs {
+				buffered += buf.Len()
+			}
+			if err = memory.check(buffered); err != nil {
+				cancel()
+			}
+		}
+	}
+
+	if dedup != nil && err == nil {
+		dedup.writeKept(outBufs)
+	}
+	for i, buf := range outBufs {
+		if err == nil && buf.Len() > 0 {
+			flush(i)
+		}
+	}
+	return err
+}
+
+// approximate nb of bytes held in memory by the translation, see --max-memory
+type memoryGuard struct {
+	limit int64
+	// the limit as given in the options, for the error
+	value string
+	// bytes of the sequences read but not translated yet
+	sequences int64
+}
+
+// returns an error if the sequences waiting to be translated and
+// the buffered bytes of the translations take more than the limit
+func (m *memoryGuard) check(buffered int) error {
+
+	total := atomic.LoadInt64(&m.sequences) + int64(buffered)
+	if total > m.limit {
+		return fmt.Errorf("more than %s of buffered data (%d bytes), see --max-memory", m.value, total)
+	}
+	return nil
+}
+
+// update the nb of bytes of the sequences waiting to be translated
+// when a sequence is read, or translated if n is negative
+func (m *memoryGuard) addSequence(n int) {
+	if m != nil {
+		atomic.AddInt64(&m.sequences, int64(n))
+	}
+}
+
+// position of a sequence in the inputs
+type sequenceKey struct {
+	input int
+	index int
+}
+
+// read the sequences of all inputs and send them to fnaSequences. Up to
+// maxReaders inputs are read at the same time. The channel is closed once
+// all inputs are read, or on the first error
+// Returns the number of sequences read
+func readInputs(ctx context.Context, inputs []input, feeder *fastaChannelFeeder, maxReaders int) (int64, error) {
+
+	defer close(feeder.fastaChan)
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// the first sequences are counted in the input order
+	if feeder.firstN > 0 || feeder.skipN > 0 {
+		maxReaders = 1
+	}
+	// inputs are started in order, so the input being
+	// written always has a reader
+	readers := make(chan struct{}, maxReaders)
+	nbSequences := make([]int, len(inputs))
+	errs := make([]error, len(inputs))
+
+	var wg sync.WaitGroup
+Loop:
+	for i, in := range inputs {
+
+		select {
+		case readers <- struct{}{}:
+		case <-ctx.Done():
+			errs[i] = ctx.Err()
+			break Loop
+		}
+		// with --first-n, the previous input is read entirely at this point
+		if feeder.done() {
+			break Loop
+		}
+		wg.Add(1)
+		go func(i int, in input) {
+			defer wg.Done()
+
+			inputFeeder := feeder.forInput(i)
+			errs[i] = readInput(ctx, in, inputFeeder)
+			if errs[i] != nil {
+				// stop the other readers, the input with an error
+				// will never be written entirely
+				cancel()
+			}
+			nbSequences[i] = inputFeeder.index
+			<-readers
+		}(i, in)
+	}
+	wg.Wait()
+
+	total := 0
+	for _, n := range nbSequences {
+		total += n
+	}
+	// inputs stopped by the error of another input return the
+	// error of the context, so the input errors are returned first
+	var interrupted error
+	for _, err := range errs {
+		switch {
+		case err == nil:
+		case isInterruption(err):
+			if interrupted == nil {
+				interrupted = err
+			}
+		default:
+			return int64(total), err
+		}
+	}
+	return int64(total), interrupted
+}
+
+// read the sequences of an input, and mark the end of the input
+func readInput(ctx context.Context, in input, feeder *fastaChannelFeeder) error {
+
+	r, err := in.open(ctx)
+	if err != nil {
+		return err
+	}
+	var reader io.Reader = r
+	if feeder.progress != nil {
+		reader = &progressReader{r: r, progress: feeder.progress}
+	}
+	reader, err = decompress(in.name, reader)
+	if err == nil {
+		if feeder.fastq {
+			err = readSequenceFromFastq(ctx, reader, feeder)
+		} else {
+			err = readSequenceFromFasta(ctx, reader, feeder)
+		}
+	}
+	r.Close()
+	switch {
+	case err != nil && isInterruption(err):
+		// not an error of the input
+		return err
+	case err != nil && ctx.Err() != nil:
+		// the download of a URL was stopped
+		return ctx.Err()
+	case err != nil:
+		return fmt.Errorf("fail to read %s: %v", in.name, err)
+	}
+	if !feeder.sendEnd(ctx) {
+		return ctx.Err()
+	}
+	return nil
+}
+
+// returns true if err is the error of a cancelled context, ie the
+// reading or the translation was stopped by a timeout or by an
+// error elsewhere
+func isInterruption(err error) bool {
+	return err == context.Canceled || err == context.DeadlineExceeded
+}
+
+// returns a reader of the decompressed content of r if
+// the name of the input ends with '.gz' or '.bz2'. stdin
+// has no name and a URL may not end with the extension,
+// so gzip is detected from their first bytes
+func decompress(name string, r io.Reader) (io.Reader, error) {
+
+	switch {
+	case name == StdinName || IsURL(name) && !strings.HasSuffix(name, ".bz2"):
+		br := bufio.NewReader(r)
+		// an empty or 1 byte input can't be gzipped
+		magic, err := br.Peek(2)
+		if err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+			return newGzipReader(br)
+		}
+		return br, nil
+	case strings.HasSuffix(name, ".gz"):
+		return newGzipReader(r)
+	case strings.HasSuffix(name, ".bz2"):
+		return bzip2.NewReader(r), nil
+	}
+	return r, nil
+}
+
+// returns a reader of all the members of a gzip file, as large
+// datasets are often several gzip files concatenated
+func newGzipReader(r io.Reader) (io.Reader, error) {
+
+	zr, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	// it's the default, but the members have to be read until
+	// the end of the input
+	zr.Multistream(true)
+	return zr, nil
+}
+
+// files exported from some editors on Windows start
+// with a UTF-8 byte order mark
+var utf8BOM = []byte{0xef, 0xbb, 0xbf}
+
+func readSequenceFromFasta(ctx context.Context, inputSequence io.Reader, feeder *fastaChannelFeeder) error {
+
+	feeder.reset()
+	// fasta format is:
+	//
+	// >sequenceID some comments on sequence
+	// ACAGGCAGAGACACGACAGACGACGACACAGGAGCAGACAGCAGCAGACGACCACATATT
+	// TTTGCGGTCACATGACGACTTCGGCAGCGA
+	//
+	// see https://blast.ncbi.nlm.nih.gov/Blast.cgi?CMD=Web&PAGE_TYPE=BlastDocs&DOC_TYPE=BlastHelp
+	// section 1 for details
+	scanner := bufio.NewScanner(inputSequence)
+	scanner.Buffer(make([]byte, 0, bufio.MaxScanTokenSize), maxInputLineSize)
+	lineNumber := 0
+Loop:
+	for scanner.Scan() {
+
+		lineNumber++
+		line := scanner.Bytes()
+		if lineNumber == 1 {
+			line = bytes.TrimPrefix(line, utf8BOM)
+		}
+		// files edited on Windows end lines with '\r\n'
+		if len(line) > 0 && line[len(line)-1] == '\r' {
+			line = line[:len(line)-1]
+		}
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		if line[0] == '>' {
+
+			if err := feeder.checkEmpty(); err != nil {
+				return err
+			}
+			if !feeder.sendFasta(ctx) {
+				return ctx.Err()
+			}
+			if feeder.done() {
+				break Loop
+			}
+			feeder.reset()
+
+			if err := feeder.startRecord(line, lineNumber); err != nil {
+				return err
+			}
+		} else {
+			// if the line doesn't start with '>', then it's a part of the
+			// nucleotide sequence, so encode it directly after the
+			// sequence read so far
+			if err := feeder.writeLine(line, lineNumber); err != nil {
+				return err
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	// don't forget to push last sequence, the input may not
+	// end with a newline or may be empty
+	if err := feeder.checkEmpty(); err != nil {
+		return err
+	}
+	if !feeder.sendFasta(ctx) {
+		return ctx.Err()
+	}
+	return nil
+}
+
+func readSequenceFromFastq(ctx context.Context, inputSequence io.Reader, feeder *fastaChannelFeeder) error {
+
+	feeder.reset()
+	// fastq format is:
+	//
+	// @readID some comments on read
+	// ACAGGCAGAGACACGACAGACGACGACACAGGAGCAGACAGCAGCAGACGACCACATATT
+	// +
+	// IIIIIIIIIIIIIIIHHHHHHHHHHHHHHHHH@@@@@@@@@@@@@@@@@++++++++++++
+	//
+	// quality lines may start with '@' or '+', so records are
+	// always read four lines at a time
+	scanner := bufio.NewScanner(inputSequence)
+	scanner.Buffer(make([]byte, 0, bufio.MaxScanTokenSize), maxInputLineSize)
+	lineNumber := 0
+	// position of the line in its record, from 0
+	recordLine := 0
+	for scanner.Scan() {
+
+		lineNumber++
+		line := scanner.Bytes()
+		if lineNumber == 1 {
+			line = bytes.TrimPrefix(line, utf8BOM)
+		}
+		if len(line) > 0 && line[len(line)-1] == '\r' {
+			line = line[:len(line)-1]
+		}
+
+		switch recordLine {
+		case 0:
+			if len(bytes.TrimSpace(line)) == 0 {
+				continue
+			}
+			if line[0] != '@' {
+				return fmt.Errorf("line %d: fastq record should start with '@'", lineNumber)
+			}
+			if err := feeder.checkEmpty(); err != nil {
+				return err
+			}
+			if !feeder.sendFasta(ctx) {
+				return ctx.Err()
+			}
+			if feeder.done() {
+				return nil
+			}
+			feeder.reset()
+
+			if err := feeder.startRecord(line, lineNumber); err != nil {
+				return err
+			}
+			// sequences are written with a fasta header
+			if feeder.current != nil {
+				(*feeder.current)[4] = '>'
+			}
+		case 1:
+			if err := feeder.writeLine(line, lineNumber); err != nil {
+				return err
+			}
+		case 2:
+			if len(line) == 0 || line[0] != '+' {
+				return fmt.Errorf("line %d: expected a '+' line after the sequence of %s", lineNumber, feeder.currentID())
+			}
+		}
+		recordLine = (recordLine + 1) % 4
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	if recordLine != 0 {
+		return fmt.Errorf("line %d: incomplete fastq record %s", lineNumber, feeder.currentID())
+	}
+	if err := feeder.checkEmpty(); err != nil {
+		return err
+	}
+	if !feeder.sendFasta(ctx) {
+		return ctx.Err()
+	}
+	return nil
+}
+
+// a type to hold an encoded fasta sequence
+//
+//	s[0:4] stores the size of the sequence id + the size of the comment as an uint32 (little endian)
+//  s[4:idSize] stores the sequence id, and the comment id there is one
+//  s[idSize:] stores the nucl sequence
+type encodedSequence []byte
+
+// pool of *encodedSequence. Pointers are stored so putting
+// a sequence back in the pool doesn't allocate
+var pool = sync.Pool{
+	New: func() interface{} {
+		s := make(encodedSequence, 512)
+		return &s
+	},
+}
+
+// get a slice of requiredSize bytes from the pool. The content of the
+// slice is not reset, so all bytes after the id size have to be written
+func getSizedSlice(idSize, requiredSize int) *encodedSequence {
+	p := pool.Get().(*encodedSequence)
+
+	if cap(*p) < requiredSize {
+		*p = make(encodedSequence, requiredSize)
+	}
+	*p = (*p)[0:requiredSize]
+	binary.LittleEndian.PutUint32((*p)[0:4], uint32(idSize))
+	return p
+}
+
+// parse the header of a record, and start a new sequence with its id and comment.
+// Header is formatted like this:
+//
+//	>sequenceID comments
+//
+// The id ends on the first space or tab. The comment is kept
+// as is, tabs included, and will be written after a single space
+func (f *fastaChannelFeeder) startRecord(line []byte, lineNumber int) error {
+
+	seqID, comment := line, []byte(nil)
+	if idEnd := bytes.IndexAny(line, " \t"); idEnd != -1 {
+		seqID, comment = line[:idEnd], bytes.TrimLeft(line[idEnd+1:], " \t")
+	}
+	if len(seqID) == 1 {
+		return fmt.Errorf("line %d: sequence has no id", lineNumber)
+	}
+	if f.selectID != nil && !f.selected(seqID[1:]) {
+		f.skip = true
+		return nil
+	}
+	if f.skipN > 0 && *f.skipped < f.skipN {
+		*f.skipped++
+		f.skip = true
+		return nil
+	}
+	if f.sample != nil && f.sample.Float64() >= f.subsample {
+		f.skip = true
+		return nil
+	}
+
+	if f.seenIDs != nil {
+		if id := string(seqID[1:]); !f.seenIDs.add(id) {
+			return fmt.Errorf("duplicate sequence id: %s", id)
+		}
+	}
+	// the frame tag is read before the comment is dropped
+	var frames []int
+	reverse := false
+	if f.frameFromHeader {
+		if tag, ok := frameTag(comment); ok {
+			var err error
+			frames, reverse, err = computeFrames(string(tag))
+			if err != nil {
+				return fmt.Errorf("line %d: invalid frame tag in sequence %s: frame=%s", lineNumber, seqID[1:], tag)
+			}
+		}
+	}
+	if f.noComment {
+		comment = nil
+	}
+	f.startSequence(seqID, comment)
+	f.frames, f.reverse = frames, reverse
+	return nil
+}
+
+// returns true if the sequence with this id has to be translated, see --id
+func (f *fastaChannelFeeder) selected(id []byte) bool {
+	if f.idPrefix {
+		return bytes.HasPrefix(id, f.selectID)
+	}
+	return bytes.Equal(id, f.selectID)
+}
+
+// returns the value of the first tag like 'frame=2' in the comment
+func frameTag(comment []byte) ([]byte, bool) {
+
+	for _, field := range bytes.Fields(comment) {
+		if bytes.HasPrefix(field, []byte("frame=")) {
+			return field[len("frame="):], true
+		}
+	}
+	return nil, false
+}
+
+// start a new sequence: write the id and the comment of the sequence
+// to a slice from the pool. The nucleotides are then appended to the
+// slice by writeLine
+func (f *fastaChannelFeeder) startSequence(seqID, comment []byte) {
+
+	f.idSize = 4 + len(seqID)
+	if len(comment) > 0 {
+		f.idSize += 1 + len(comment)
+	}
+	// circular sequences are stored with their last two nucleotides
+	// before them, and their first two nucleotides after them:
+	//   F[L-2:] + F + F[:2]
+	// so both the sequence and its reverse-complement can be read
+	// past their end from position 2. Keep room for the first two,
+	// they are written by sendFasta
+	f.seqStart = f.idSize
+	if f.circular {
+		f.seqStart += 2
+	}
+
+	f.current = getSizedSlice(f.idSize, f.seqStart)
+	f.gcCount, f.atCount = 0, 0
+	f.frames, f.reverse = nil, false
+	f.rna = false
+	s := *f.current
+
+	copy(s[4:], seqID)
+	if len(comment) > 0 {
+		s[4+len(seqID)] = ' '
+		copy(s[5+len(seqID):], comment)
+	}
+}
+
+// encode a line of the nucleotide sequence, and append it to
+// the current sequence
+func (f *fastaChannelFeeder) writeLine(line []byte, lineNumber int) error {
+
+	if f.skip {
+		return nil
+	}
+	if f.current == nil {
+		// nucleotides before the first id are skipped, but
+		// are an error when validating
+		if f.strict {
+			return fmt.Errorf("line %d: sequence data before the first header", lineNumber)
+		}
+		return nil
+	}
+	// the first line of the input is enough to detect a protein
+	// sequence, before a warning for each AA
+	if f.checkSeqType && f.index == 0 && f.nbRead == 0 && looksLikeProtein(line) {
+		return fmt.Errorf("line %d: input appears to be protein, not nucleotide (sequence %s), use --force-nucleotide to translate it anyway", lineNumber, f.currentID())
+	}
+
+	// only keep the part of the line in the region
+	lineStart := f.nbRead
+	f.nbRead += len(line)
+	line = f.region.slice(line, lineStart)
+
+	s := *f.current
+	n := len(s)
+	s = append(s, line...)
+
+	// convert the sequence of bytes to an array of uint8 codes,
+	// so a codon (3 nucleotides | 3 bytes ) can be represented
+	// as an uint32
+	for i, b := range s[n:] {
+
+		// lowercase nucleotides are soft-masked, with
+		// --preserve-case their case is kept
+		lower := uint8(0)
+		if b >= 'a' && b <= 'z' {
+			b -= 'a' - 'A'
+			if f.preserveCase {
+				lower = softMasked
+			}
+		}
+		switch b {
+		case 'A':
+			s[i+n] = aCode | lower
+			f.atCount++
+		case 'C':
+			s[i+n] = cCode | lower
+			f.gcCount++
+		case 'G':
+			s[i+n] = gCode | lower
+			f.gcCount++
+		case 'T':
+			s[i+n] = tCode | lower
+			f.atCount++
+		case 'U':
+			s[i+n] = uCode | lower
+			f.atCount++
+			f.rna = true
+		case 'N':
+			s[i+n] = nCode | lower
+		case '-':
+			s[i+n] = gapCode
+		case 'R', 'Y', 'S', 'W', 'K', 'M', 'B', 'D', 'H', 'V':
+			// the codons with an ambiguity code are counted
+			// apart in the summary
+			s[i+n] = ambiguousCode
+		default:
+			if f.strict {
+				return fmt.Errorf("line %d: invalid char in sequence %s: %s", lineNumber, f.currentID(), string(s[i+n]))
+			}
+			fmt.Fprintf(f.warnings, "WARNING: line %d: invalid char in sequence %s: %s, ignoring\n", lineNumber, f.currentID(), string(s[i+n]))
+			s[i+n] = nCode
+		}
+	}
+	*f.current = s
+	return nil
+}
+
+// letters of AA that are neither a nucleotide nor an IUPAC ambiguity code.
+// 'X' is not one of them, as it may mask nucleotides
+const proteinOnlyLetters = "EFIJLOPQZ"
+
+// returns true if at least 10% of the letters of a sequence line
+// can only be AA
+func looksLikeProtein(line []byte) bool {
+
+	letters, protein := 0, 0
+	for _, b := range line {
+		if b >= 'a' && b <= 'z' {
+			b -= 'a' - 'A'
+		}
+		if b < 'A' || b > 'Z' {
+			continue
+		}
+		letters++
+		if strings.IndexByte(proteinOnlyLetters, b) != -1 {
+			protein++
+		}
+	}
+	return letters > 0 && 10*protein >= letters
+}
+
+// returns the id of the current sequence, without the leading '>'.
+// Skipped sequences have no id
+func (f *fastaChannelFeeder) currentID() []byte {
+
+	if f.current == nil {
+		return nil
+	}
+
+	id := (*f.current)[4:f.idSize]
+	if idEnd := bytes.IndexByte(id, ' '); idEnd != -1 {
+		id = id[:idEnd]
+	}
+	if len(id) > 0 {
+		id = id[1:]
+	}
+	return id
+}
+
+// returns an error if empty sequences are rejected and the
+// current sequence has no nucleotides
+func (f *fastaChannelFeeder) checkEmpty() error {
+
+	if f.rejectEmpty && f.current != nil && f.nbRead == 0 {
+		return fmt.Errorf("sequence %s has no nucleotides", f.currentID())
+	}
+	return nil
+}
+
+// send the current sequence to the channel, if a sequence is started.
+// Returns false if the context is cancelled before the sequence could
+// be sent
+func (f *fastaChannelFeeder) sendFasta(ctx context.Context) bool {
+
+	if f.current == nil {
+		return true
+	}
+	select {
+	case <-ctx.Done():
+		f.reset()
+		return false
+	default:
+	}
+
+	p := f.current
+	f.current = nil
+	s := *p
+
+	if f.stripN {
+		s = stripN(s, f.seqStart)
+	}
+	if f.circular {
+		l := len(s) - f.seqStart
+		if l == 0 {
+			// nothing to wrap, drop the room kept for the wrapped nucleotides
+			s = s[:f.idSize]
+		} else {
+			// sequences shorter than 2 nucleotides wrap several times
+			for k := 0; k < 2; k++ {
+				s[f.idSize+1-k] = s[f.seqStart+l-1-k%l]
+				s = append(s, s[f.seqStart+k%l])
+			}
+		}
+	}
+	*p = s
+
+	// wait for a slot before sending the sequence
+	select {
+	case f.inFlight <- struct{}{}:
+	case <-ctx.Done():
+		pool.Put(p)
+		return false
+	}
+	f.memory.addSequence(len(s))
+	f.fastaChan <- indexedSequence{
+		input:    f.input,
+		index:    f.index,
+		sequence: p,
+		inFlight: f.inFlight,
+		gcCount:  f.gcCount,
+		atCount:  f.atCount,
+		frames:   f.frames,
+		reverse:  f.reverse,
+		rna:      f.rna,
+	}
+	f.index++
+	if f.sent != nil {
+		*f.sent++
+	}
+	if f.progress != nil {
+		atomic.AddInt64(&f.progress.sequences, 1)
+	}
+	return true
+}
+
+// returns true if no more sequence has to be read, see --first-n
+func (f *fastaChannelFeeder) done() bool {
+	return f.firstN > 0 && *f.sent >= f.firstN
+}
+
+// remove the leading and trailing 'N' and ambiguity codes of the
+// nucleotides of s, starting at seqStart
+func stripN(s []byte, seqStart int) []byte {
+
+	end := len(s)
+	for end > seqStart && isUnknownCode(s[end-1]&^softMasked) {
+		end--
+	}
+	start := seqStart
+	for start < end && isUnknownCode(s[start]&^softMasked) {
+		start++
+	}
+	return append(s[:seqStart], s[start:end]...)
+}
+
+// returns true for the codes of 'N' and of the ambiguity codes
+func isUnknownCode(c uint8) bool {
+	return c == nCode || c == ambiguousCode
+}
+
+// send a sequence without nucleotides or id after the last sequence
+// of the input, so the next input can be written. Returns false if
+// the context is cancelled before
+func (f *fastaChannelFeeder) sendEnd(ctx context.Context) bool {
+
+	if ctx.Err() != nil {
+		return false
+	}
+	select {
+	case f.inFlight <- struct{}{}:
+	case <-ctx.Done():
+		return false
+	}
+	f.fastaChan <- indexedSequence{input: f.input, index: f.index, inFlight: f.inFlight}
+	return true
+}
+
+// an encoded sequence with its position in the inputs. A nil
+// sequence marks the end of the input
+type indexedSequence struct {
+	input    int
+	index    int
+	sequence *encodedSequence
+	// slots of the input, released once the sequence is written
+	inFlight chan struct{}
+	// nb of G or C, and of A or T of the sequence
+	gcCount int
+	atCount int
+	// frames of the header tag, nil if the sequence has no tag
+	frames  []int
+	reverse bool
+	// the sequence has a 'U'
+	rna bool
+}
+
+type fastaChannelFeeder struct {
+	// sequence being read, nil if no sequence is started
+	current *encodedSequence
+	// size of the id of the current sequence, with the 4 bytes
+	// storing it, and position of its first nucleotide
+	idSize   int
+	seqStart int
+	// nb of nucleotides of the current sequence read so far,
+	// including the ones out of the region
+	nbRead int
+	// nb of G or C, and of A or T of the current sequence, in the region
+	gcCount int
+	atCount int
+	// the current sequence has a 'U' in the region
+	rna bool
+	// frames of the header tag of the current sequence, see --frame-from-header
+	frameFromHeader bool
+	frames          []int
+	reverse         bool
+	// don't keep the comments of the sequences
+	noComment bool
+	// keep the case of the nucleotides, see --preserve-case
+	preserveCase bool
+	// fraction of the sequences to keep, and seed of the random
+	// selection, see --subsample. The source of the input is nil
+	// if all sequences are kept
+	subsample float64
+	seed      int64
+	sample    *rand.Rand
+	// check that the first sequence of the input isn't a protein
+	// sequence, see --force-nucleotide
+	checkSeqType bool
+	// nil if there is no memory limit, see --max-memory
+	memory *memoryGuard
+	// if not nil, only the sequences with this id, or with an id
+	// starting with it if idPrefix is set, are sent, see --id. skip
+	// is set while the lines of another sequence are read
+	selectID  []byte
+	idPrefix  bool
+	skip      bool
+	fastaChan chan indexedSequence
+	// position of the input, and of the next sequence in the input
+	input int
+	index int
+	// a slot is taken for each sequence sent, and released once it's
+	// written. Each input has its own slots, so a reader waiting for a
+	// slot never blocks the input being written
+	inFlight    chan struct{}
+	maxInFlight int
+	// ids of the sequences read so far, only
+	// used to detect duplicate ids
+	seenIDs *idSet
+	// if firstN > 0, only the first firstN sequences are sent, see
+	// --first-n, after the first skipN sequences, see --skip. The
+	// inputs are read one at a time, so the counters are shared by
+	// the inputs without locking
+	firstN  int
+	sent    *int
+	skipN   int
+	skipped *int
+	// part of the sequences to translate
+	region region
+	// wrap the sequences around the origin
+	circular bool
+	// remove the leading and trailing 'N' of the sequences
+	stripN bool
+	// may be nil
+	progress *Progress
+	warnings io.Writer
+	// invalid chars are errors instead of warnings
+	strict bool
+	// sequences without nucleotides are errors
+	rejectEmpty bool
+	// inputs are in fastq format
+	fastq bool
+}
+
+// returns a feeder with the configuration of all inputs. Each input is read
+// by a feeder returned by forInput
+func newFastaChannelFeeder(fastaChan chan indexedSequence, maxInFlight int, options Options) (*fastaChannelFeeder, error) {
+
+	feeder := &fastaChannelFeeder{
+		fastaChan:   fastaChan,
+		maxInFlight: maxInFlight,
+		circular:    options.Circular,
+		stripN:      options.StripN,
+		progress:    options.Progress,
+		rejectEmpty: options.RejectEmpty,
+		fastq:       options.Fastq,
+
+		frameFromHeader: options.FrameFromHeader,
+		noComment:       options.NoComment,
+		preserveCase:    options.PreserveCase,
+		checkSeqType:    !options.ForceNucleotide,
+		idPrefix:        options.IDPrefix,
+	}
+	if options.ID != "" {
+		feeder.selectID = []byte(options.ID)
+	}
+	switch {
+	case options.FirstN < 0:
+		return nil, fmt.Errorf("wrong value for --first-n parameter: %d, must be positive", options.FirstN)
+	case options.FirstN > 0:
+		feeder.firstN = options.FirstN
+		feeder.sent = new(int)
+	}
+	switch {
+	case options.Skip < 0:
+		return nil, fmt.Errorf("wrong value for --skip parameter: %d, must be positive", options.Skip)
+	case options.Skip > 0:
+		feeder.skipN = options.Skip
+		feeder.skipped = new(int)
+	}
+	if options.Subsample < 0 || options.Subsample > 1 {
+		return nil, fmt.Errorf("wrong value for --subsample parameter: %v, must be between 0 and 1", options.Subsample)
+	}
+	if options.Subsample > 0 {
+		// without seed, the selection changes on each run
+		feeder.subsample, feeder.seed = options.Subsample, time.Now().UnixNano()
+		if options.Seed != nil {
+			feeder.seed = *options.Seed
+		}
+	}
+	// inputs read at the same time share the warnings
+	warnings := options.Warnings
+	if warnings == nil {
+		warnings = os.Stderr
+	}
+	feeder.warnings = &syncWriter{w: warnings}
+	if options.CheckIDs {
+		feeder.seenIDs = &idSet{ids: map[string]struct{}{}}
+	}
+
+	var err error
+	feeder.region, err = parseRegion(options.Region)
+	if err != nil {
+		return nil, err
+	}
+	return feeder, nil
+}
+
+// returns a feeder for the input at position inputIndex, with its own slots
+func (f *fastaChannelFeeder) forInput(inputIndex int) *fastaChannelFeeder {
+
+	inputFeeder := *f
+	inputFeeder.input = inputIndex
+	inputFeeder.inFlight = make(chan struct{}, f.maxInFlight)
+	if f.subsample > 0 {
+		// inputs may be read at the same time, so each input has
+		// its own source for the selection to be reproducible
+		inputFeeder.sample = rand.New(rand.NewSource(f.seed + int64(inputIndex)))
+	}
+	return &inputFeeder
+}
+
+// a set of ids shared by the inputs read at the same time
+type idSet struct {
+	sync.Mutex
+	ids map[string]struct{}
+}
+
+// add id to the set. Returns false if the id was already in the set
+func (s *idSet) add(id string) bool {
+
+	s.Lock()
+	defer s.Unlock()
+	if _, ok := s.ids[id]; ok {
+		return false
+	}
+	s.ids[id] = struct{}{}
+	return true
+}
+
+// a writer safe for concurrent use
+type syncWriter struct {
+	sync.Mutex
+	w io.Writer
+}
+
+func (s *syncWriter) Write(b []byte) (int, error) {
+
+	s.Lock()
+	defer s.Unlock()
+	return s.w.Write(b)
+}
+
+// a region of the sequences to translate. Like in EMBOSS, positions
+// start at 1 and end is inclusive. The zero value is the whole sequence
+type region struct {
+	start int
+	end   int
+}
+
+func parseRegion(regionName string) (region, error) {
+
+	if regionName == "" {
+		return region{}, nil
+	}
+
+	bounds := strings.Split(regionName, "-")
+	if len(bounds) == 2 {
+		start, startErr := strconv.Atoi(bounds[0])
+		end, endErr := strconv.Atoi(bounds[1])
+		if startErr == nil && endErr == nil && start >= 1 && end >= start {
+			return region{start: start, end: end}, nil
+		}
+	}
+	return region{}, fmt.Errorf("wrong value for --region parameter: %s, expected <start>-<end> with 1 <= start <= end", regionName)
+}
+
+// returns the part of the nucleotides in the region. The nucleotides
+// are a part of the sequence starting at position offset (from 0)
+func (r region) slice(nucleotides []byte, offset int) []byte {
+
+	if r.start == 0 {
+		return nucleotides
+	}
+	start, end := clamp(r.start-1-offset, len(nucleotides)), clamp(r.end-offset, len(nucleotides))
+	if start > end {
+		start = end
+	}
+	return nucleotides[start:end]
+}
+
+// returns v bounded to [0, max]
+func clamp(v, max int) int {
+	if v < 0 {
+		return 0
+	}
+	if v > max {
+		return max
+	}
+	return v
+}
+
+// drop the current sequence
+func (f *fastaChannelFeeder) reset() {
+	if f.current != nil {
+		pool.Put(f.current)
+		f.current = nil
+	}
+	f.nbRead = 0
+	f.skip = false
 }
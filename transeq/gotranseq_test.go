@@ -2,13 +2,23 @@ package transeq_test
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
 	"strconv"
 	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/feliixx/gotranseq/transeq"
 	"github.com/jessevdk/go-flags"
@@ -64,6 +74,3465 @@ func TestAllOptions(t *testing.T) {
 	}
 }
 
+func TestAlternativeStart(t *testing.T) {
+
+	tests := []struct {
+		name     string
+		options  string
+		input    string
+		expected string
+	}{
+		{
+			name:     "table 0 TTG",
+			options:  "-table=0 -alternative-start",
+			input:    ">s1\nTTGTTGATG\n",
+			expected: ">s1_1\nLLM\n",
+		},
+		{
+			name:     "table 1 TTG",
+			options:  "-table=1 -alternative-start",
+			input:    ">s1\nTTGTTGATG\n",
+			expected: ">s1_1\nMLM\n",
+		},
+		{
+			name:     "table 1 without alternative-start",
+			options:  "-table=1",
+			input:    ">s1\nTTGTTGATG\n",
+			expected: ">s1_1\nLLM\n",
+		},
+		{
+			name:     "table 11 GTG",
+			options:  "-table=11 -alternative-start",
+			input:    ">s1\nGTGGTGTAA\n",
+			expected: ">s1_1\nMV*\n",
+		},
+		{
+			name:     "table 11 not a start codon",
+			options:  "-table=11 -alternative-start",
+			input:    ">s1\nCCCGTGTAA\n",
+			expected: ">s1_1\nPV*\n",
+		},
+		{
+			name:     "table 11 reverse frame",
+			options:  "-table=11 -frame=-1 -alternative-start",
+			input:    ">s1\nCACCAC\n",
+			expected: ">s1_4\nMV\n",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := translateString(test.options, test.input)
+			if err != nil {
+				t.Error(err)
+			}
+			if want := test.expected; want != got {
+				t.Errorf("expected\n%s\nbut got\n%s\n", want, got)
+			}
+		})
+	}
+}
+
+func TestForceStartMet(t *testing.T) {
+
+	input := ">s1\nCCCGTGTAA\n"
+
+	tests := []struct {
+		name     string
+		options  string
+		expected string
+	}{
+		{
+			name:     "without force-start-met",
+			options:  "-frame=6",
+			expected: ">s1_1\nPV*\n>s1_2\nPCX\n>s1_3\nRVX\n>s1_4\nLHG\n>s1_5\nTRX\n>s1_6\nYTG\n",
+		},
+		{
+			name:     "all frames",
+			options:  "-frame=6 -force-start-met",
+			expected: ">s1_1\nMV*\n>s1_2\nMCX\n>s1_3\nMVX\n>s1_4\nMHG\n>s1_5\nMRX\n>s1_6\nMTG\n",
+		},
+		{
+			name:     "with alternative-start",
+			options:  "-table=11 -frame=1 -force-start-met -alternative-start",
+			expected: ">s1_1\nMV*\n",
+		},
+		{
+			name:     "first codon starts an orf",
+			options:  "-frame=1 -force-start-met -orf=1",
+			expected: ">s1_1_1 [1 - 9]\nMV\n",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := translateString(test.options, input)
+			if err != nil {
+				t.Error(err)
+			}
+			if want := test.expected; want != got {
+				compareByline(t, want, got)
+			}
+		})
+	}
+}
+
+func TestStopChar(t *testing.T) {
+
+	tests := []struct {
+		name     string
+		options  string
+		input    string
+		expected string
+		err      bool
+	}{
+		{
+			name:     "default",
+			options:  "-frame=1",
+			input:    ">s1\nATGTAAATGTGA\n",
+			expected: ">s1_1\nM*M*\n",
+		},
+		{
+			name:     "dot",
+			options:  "-stopchar=.",
+			input:    ">s1\nATGTAAATGTGA\n",
+			expected: ">s1_1\nM.M.\n",
+		},
+		{
+			name:     "dot with trim",
+			options:  "-stopchar=. -trim",
+			input:    ">s1\nATGTAAATGTGANN\n",
+			expected: ">s1_1\nM.M\n",
+		},
+		{
+			name:     "clean takes precedence",
+			options:  "-stopchar=. -clean",
+			input:    ">s1\nATGTAAATG\n",
+			expected: ">s1_1\nMXM\n",
+		},
+		{
+			name:    "more than one char",
+			options: "-stopchar=..",
+			input:   ">s1\nATGTAAATG\n",
+			err:     true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := translateString(test.options, test.input)
+			if test.err {
+				if err == nil {
+					t.Errorf("expected an error but got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Error(err)
+			}
+			if want := test.expected; want != got {
+				t.Errorf("expected\n%s\nbut got\n%s\n", want, got)
+			}
+		})
+	}
+}
+
+func TestClean(t *testing.T) {
+
+	tests := []struct {
+		name     string
+		options  string
+		expected string
+	}{
+		{name: "internal and terminal stops", options: "-frame=1 -clean", expected: ">s1_1\nMXMXX\n"},
+		{name: "with trim", options: "-frame=1 -clean -trim", expected: ">s1_1\nMXM\n"},
+		{name: "three-letter", options: "-frame=1 -clean -three-letter", expected: ">s1_1\nMet Xaa Met Xaa Xaa\n"},
+		{name: "jsonl", options: "-frame=1 -clean -format=jsonl", expected: `{"id":"s1","frame":1,"comment":"","protein":"MXMXX"}` + "\n"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := translateString(test.options, ">s1\nATGTAAATGTGANN\n")
+			if err != nil {
+				t.Error(err)
+			}
+			if want := test.expected; want != got {
+				t.Errorf("expected\n%s\nbut got\n%s\n", want, got)
+			}
+		})
+	}
+}
+
+func TestUnknownChar(t *testing.T) {
+
+	tests := []struct {
+		name     string
+		options  string
+		input    string
+		expected string
+		err      bool
+	}{
+		{
+			name:     "default",
+			options:  "-frame=1",
+			input:    ">s1\nATGNNNTAAAT\n>s2\nATGNNNTAAA\n",
+			expected: ">s1_1\nMX*X\n>s2_1\nMX*X\n",
+		},
+		{
+			// N codon, incomplete codon of 2 and 1 nucleotides
+			name:     "question mark",
+			options:  "-frame=1 -unknown-char=?",
+			input:    ">s1\nATGNNNTAAAT\n>s2\nATGNNNTAAA\n",
+			expected: ">s1_1\nM?*?\n>s2_1\nM?*?\n",
+		},
+		{
+			name:     "with clean",
+			options:  "-frame=1 -unknown-char=- -clean",
+			input:    ">s1\nATGNNNTAAAT\n",
+			expected: ">s1_1\nM-X-\n",
+		},
+		{
+			name:     "with trim",
+			options:  "-frame=1 -unknown-char=? -trim",
+			input:    ">s1\nATGNNNTAAAT\n",
+			expected: ">s1_1\nM\n",
+		},
+		{
+			name:     "tsv",
+			options:  "-frame=1 -unknown-char=? -format=tsv",
+			input:    ">s1\nATGNNNTAAAT\n",
+			expected: "s1\t1\t4\tM?*?\n",
+		},
+		{
+			name:     "internal and terminal",
+			options:  "-frame=1 -internal-unknown=. -terminal-unknown=-",
+			input:    ">s1\nATGNNNTAAAT\n>s2\nATGNNNTAAA\n",
+			expected: ">s1_1\nM.*-\n>s2_1\nM.*-\n",
+		},
+		{
+			name:     "terminal overrides unknown-char",
+			options:  "-frame=1 -unknown-char=? -terminal-unknown=-",
+			input:    ">s1\nATGNNNTAAAT\n",
+			expected: ">s1_1\nM?*-\n",
+		},
+		{
+			name:     "internal only",
+			options:  "-frame=1 -internal-unknown=.",
+			input:    ">s1\nATGNNNTAAAT\n",
+			expected: ">s1_1\nM.*X\n",
+		},
+		{
+			// GCA, GCC, GCG and GCT are all Ala
+			name:     "incomplete codon translated",
+			options:  "-frame=1 -internal-unknown=. -terminal-unknown=-",
+			input:    ">s1\nATGNNNGC\n",
+			expected: ">s1_1\nM.A\n",
+		},
+		{
+			name:     "complete last codon",
+			options:  "-frame=1 -internal-unknown=. -terminal-unknown=-",
+			input:    ">s1\nATGNNN\n",
+			expected: ">s1_1\nM.\n",
+		},
+		{
+			name:     "jsonl",
+			options:  "-frame=1 -internal-unknown=. -terminal-unknown=- -format=jsonl",
+			input:    ">s1\nATGNNNTAAAT\n",
+			expected: `{"id":"s1","frame":1,"comment":"","protein":"M.*-"}` + "\n",
+		},
+		{
+			name:    "more than one char",
+			options: "-unknown-char=??",
+			input:   ">s1\nATGNNN\n",
+			err:     true,
+		},
+		{
+			name:    "terminal more than one char",
+			options: "-terminal-unknown=--",
+			input:   ">s1\nATGNNN\n",
+			err:     true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := translateString(test.options, test.input)
+			if test.err {
+				if err == nil {
+					t.Errorf("expected an error but got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Error(err)
+			}
+			if want := test.expected; want != got {
+				t.Errorf("expected\n%s\nbut got\n%s\n", want, got)
+			}
+		})
+	}
+}
+
+func TestRejectEmpty(t *testing.T) {
+
+	tests := []struct {
+		name     string
+		options  string
+		input    string
+		expected string
+		err      string
+	}{
+		{
+			name:     "empty sequences allowed",
+			options:  "-frame=1",
+			input:    ">a\n>b\nACGT\n",
+			expected: ">a_1\n>b_1\nTX\n",
+		},
+		{
+			name:    "empty sequence",
+			options: "-frame=1 -reject-empty",
+			input:   ">a\n>b\nACGT\n",
+			err:     "sequence a has no nucleotides",
+		},
+		{
+			name:    "empty last sequence",
+			options: "-frame=1 -reject-empty",
+			input:   ">a\nACGT\n>b comment\n\n",
+			err:     "sequence b has no nucleotides",
+		},
+		{
+			name:     "sequence out of the region",
+			options:  "-frame=1 -reject-empty -region=5-6",
+			input:    ">a\nACGT\n",
+			expected: ">a_1\n",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := translateString(test.options, test.input)
+			if test.err != "" {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Errorf("expected error '%s' but got %v", test.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Error(err)
+			}
+			if want := test.expected; want != got {
+				t.Errorf("expected\n%s\nbut got\n%s\n", want, got)
+			}
+		})
+	}
+}
+
+func TestFrameFromHeader(t *testing.T) {
+
+	input := ">a frame=2 some comment\nATGGCCAAATTT\n>b no tag\nATGGCCAAATTT\n>c frame=-1\nATGGCCAAATTT\n"
+
+	tests := []struct {
+		name     string
+		options  string
+		input    string
+		expected string
+		err      string
+	}{
+		{
+			name:     "tagged and untagged",
+			options:  "-frame=1 -frame-from-header",
+			input:    input,
+			expected: ">a_2 frame=2 some comment\nWPNX\n>b_1 no tag\nMAKF\n>c_4 frame=-1\nKFGH\n",
+		},
+		{
+			name:     "tags ignored",
+			options:  "-frame=1",
+			input:    input,
+			expected: ">a_1 frame=2 some comment\nMAKF\n>b_1 no tag\nMAKF\n>c_1 frame=-1\nMAKF\n",
+		},
+		{
+			name:     "several frames",
+			options:  "-frame=-1 -frame-from-header",
+			input:    ">a frame=1,-1\nATGGCCAAATTT\n",
+			expected: ">a_1 frame=1,-1\nMAKF\n>a_4 frame=1,-1\nKFGH\n",
+		},
+		{
+			name:    "invalid tag",
+			options: "-frame=1 -frame-from-header",
+			input:   ">a frame=7\nATGGCCAAATTT\n",
+			err:     "line 1: invalid frame tag in sequence a: frame=7",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := translateString(test.options, test.input)
+			if test.err != "" {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Errorf("expected error '%s' but got %v", test.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Error(err)
+			}
+			if want := test.expected; want != got {
+				t.Errorf("expected\n%s\nbut got\n%s\n", want, got)
+			}
+		})
+	}
+
+	// with --split, only the frames of -f | --frame have a writer
+	outs := []io.Writer{ioutil.Discard, nil, nil, nil, nil, nil}
+	options := transeq.Options{Optional: transeq.Optional{Frame: "1", FrameFromHeader: true, NumWorker: 1}}
+	_, err := transeq.TranslateFilesSplit([]string{"testdata/test.fna"}, outs, options)
+	if err == nil {
+		t.Errorf("expected an error for missing writers")
+	}
+
+	// the stats only have the frames of -f | --frame
+	options.Stats = ioutil.Discard
+	_, err = transeq.TranslateFiles([]string{"testdata/test.fna"}, ioutil.Discard, options)
+	if err == nil || !strings.Contains(err.Error(), "--stats can't be used with --frame-from-header") {
+		t.Errorf("expected an error for --stats with --frame-from-header, but got %v", err)
+	}
+}
+
+func TestComposition(t *testing.T) {
+
+	options := transeq.Options{
+		Optional: transeq.Optional{
+			Frame:     "1",
+			NumWorker: 2,
+		},
+	}
+	var composition bytes.Buffer
+	options.Composition = &composition
+
+	// proteins are MA* and FP
+	input := ">other1\nATGGCCTGA\n>other2\nTTTCCC\n"
+	err := transeq.TranslateStream(strings.NewReader(input), ioutil.Discard, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lines := strings.Split(strings.TrimSuffix(composition.String(), "\n"), "\n")
+	if len(lines) != 23 {
+		t.Fatalf("expected a header and 22 AA but got %d lines:\n%s", len(lines), composition.String())
+	}
+	if want := "aa\tcount\tfrequency"; lines[0] != want {
+		t.Errorf("expected header '%s' but got '%s'", want, lines[0])
+	}
+	want := map[string]string{
+		"A": "A\t1\t0.2000",
+		"F": "F\t1\t0.2000",
+		"M": "M\t1\t0.2000",
+		"P": "P\t1\t0.2000",
+		"*": "*\t1\t0.2000",
+	}
+	for _, line := range lines[1:] {
+		aa := line[:1]
+		if expected, ok := want[aa]; ok && line != expected {
+			t.Errorf("expected '%s' but got '%s'", expected, line)
+		}
+		if _, ok := want[aa]; !ok && !strings.HasSuffix(line, "\t0\t0.0000") {
+			t.Errorf("expected no occurrence of %s but got '%s'", aa, line)
+		}
+	}
+	if !strings.HasPrefix(lines[21], "*\t") || !strings.HasPrefix(lines[22], "X\t") {
+		t.Errorf("expected '*' and 'X' after the standard AA but got\n%s", composition.String())
+	}
+}
+
+func TestReadFasta(t *testing.T) {
+
+	input := ">s1 first sequence\nACGT\nN-U\n>s2\n\nGGA\n"
+	sequences, errs := transeq.ReadFasta(strings.NewReader(input))
+
+	var got []transeq.FastaSequence
+	for s := range sequences {
+		got = append(got, s)
+	}
+	if err := <-errs; err != nil {
+		t.Error(err)
+	}
+	want := []transeq.FastaSequence{
+		{ID: "s1", Comment: "first sequence", Sequence: []byte{1, 2, 4, 3, 0, 5, 3}},
+		{ID: "s2", Sequence: []byte{4, 4, 1}},
+	}
+	if !reflect.DeepEqual(want, got) {
+		t.Errorf("expected %v but got %v", want, got)
+	}
+
+	// sequences before the error are sent
+	sequences, errs = transeq.ReadFasta(strings.NewReader(">s1\nACGT\n>\nACGT\n>s3\nACGT\n"))
+	got = got[:0]
+	for s := range sequences {
+		got = append(got, s)
+	}
+	if len(got) != 1 || got[0].ID != "s1" {
+		t.Errorf("expected only sequence s1 but got %v", got)
+	}
+	if err := <-errs; err == nil || !strings.Contains(err.Error(), "line 3: sequence has no id") {
+		t.Errorf("expected error containing 'line 3: sequence has no id' but got %v", err)
+	}
+}
+
+func TestDataBeforeHeader(t *testing.T) {
+
+	// the nucleotides before the first header are skipped
+	input := "testdata/data_before_header.fna"
+	options := transeq.Options{Optional: transeq.Optional{Frame: "1", NumWorker: 2}}
+	var out bytes.Buffer
+	if _, err := transeq.TranslateFiles([]string{input}, &out, options); err != nil {
+		t.Error(err)
+	}
+	if want := ">s1_1\nK\n"; out.String() != want {
+		t.Errorf("expected\n%s\nbut got\n%s", want, out.String())
+	}
+
+	content, err := ioutil.ReadFile(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sequences, errs := transeq.ReadFasta(bytes.NewReader(content))
+	var got []transeq.FastaSequence
+	for s := range sequences {
+		got = append(got, s)
+	}
+	if err := <-errs; err != nil {
+		t.Error(err)
+	}
+	if want := []transeq.FastaSequence{{ID: "s1", Sequence: []byte{1, 1, 1}}}; !reflect.DeepEqual(want, got) {
+		t.Errorf("expected %v but got %v", want, got)
+	}
+
+	// but they are an error when validating
+	_, err = transeq.ValidateFiles([]string{input}, transeq.Options{Optional: transeq.Optional{NumWorker: 1}})
+	if want := "line 1: sequence data before the first header"; err == nil || !strings.Contains(err.Error(), want) {
+		t.Errorf("expected error containing '%s' but got %v", want, err)
+	}
+}
+
+func TestCodonUsage(t *testing.T) {
+
+	options := transeq.Options{
+		Optional: transeq.Optional{
+			Frame:     "-1",
+			NumWorker: 2,
+		},
+	}
+	var usage bytes.Buffer
+	options.CodonUsage = &usage
+
+	// codons with a 'N' and incomplete codons are not counted
+	input := ">s1\nATGAAAATGNNNTA\n>s2\nAAAGCT\n"
+	err := transeq.TranslateStream(strings.NewReader(input), ioutil.Discard, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lines := strings.Split(strings.TrimSuffix(usage.String(), "\n"), "\n")
+	if len(lines) != 65 {
+		t.Fatalf("expected a header and 64 codons but got %d lines:\n%s", len(lines), usage.String())
+	}
+	if want := "codon\taa\tcount\tfrequency"; lines[0] != want {
+		t.Errorf("expected header '%s' but got '%s'", want, lines[0])
+	}
+	want := map[string]string{
+		"AAA": "AAA\tK\t2\t0.4000",
+		"ATG": "ATG\tM\t2\t0.4000",
+		"GCT": "GCT\tA\t1\t0.2000",
+		"TAA": "TAA\t*\t0\t0.0000",
+	}
+	for _, line := range lines[1:] {
+		codon := line[:3]
+		if expected, ok := want[codon]; ok && line != expected {
+			t.Errorf("expected '%s' but got '%s'", expected, line)
+		}
+		if _, ok := want[codon]; !ok && !strings.HasSuffix(line, "\t0\t0.0000") {
+			t.Errorf("expected no occurrence of codon %s but got '%s'", codon, line)
+		}
+	}
+}
+
+func TestRNAOutput(t *testing.T) {
+
+	input := ">r1 rna\nAUGGCCUAA\n>d1\nATGGCCTAA\n"
+
+	got, err := translateString("-frame=1,-1 -rna-output", input)
+	if err != nil {
+		t.Error(err)
+	}
+	want := ">r1_1 rna molecule=RNA\nMA*\n>r1_4 rna molecule=RNA\nLGH\n>d1_1\nMA*\n>d1_4\nLGH\n"
+	if got != want {
+		compareByline(t, want, got)
+	}
+
+	// RNA sequences are not noted by default
+	got, err = translateString("-frame=1", input)
+	if err != nil {
+		t.Error(err)
+	}
+	if want := ">r1_1 rna\nMA*\n>d1_1\nMA*\n"; got != want {
+		t.Errorf("expected\n%s\nbut got\n%s\n", want, got)
+	}
+
+	options := transeq.Options{Optional: transeq.Optional{Frame: "1", RNAOutput: true, NumWorker: 1}}
+	var usage bytes.Buffer
+	options.CodonUsage = &usage
+	if err := transeq.TranslateStream(strings.NewReader(input), ioutil.Discard, options); err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{"\nAUG\tM\t2\t0.3333\n", "\nUAA\t*\t2\t0.3333\n"} {
+		if !strings.Contains(usage.String(), line) {
+			t.Errorf("expected codon usage to contain '%s' but got\n%s", line, usage.String())
+		}
+	}
+	for _, line := range strings.Split(usage.String(), "\n") {
+		if codon := strings.SplitN(line, "\t", 2)[0]; strings.Contains(codon, "T") {
+			t.Errorf("expected no 'T' in codons but got %s", codon)
+		}
+	}
+}
+
+func TestRecodedStopCodons(t *testing.T) {
+
+	input := ">s1\nATGTGATAGAAATAA\n"
+
+	tests := []struct {
+		name     string
+		options  string
+		expected string
+	}{
+		{
+			name:     "one-letter",
+			options:  "",
+			expected: ">s1_1\nMUOK*\n",
+		},
+		{
+			name:     "three-letter",
+			options:  "-three-letter",
+			expected: ">s1_1\nMet Sec Pyl Lys Stop\n",
+		},
+		{
+			name:     "orf",
+			options:  "-orf=1",
+			expected: ">s1_1_1 [1 - 15]\nMUOK\n",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := translateString("-table-file=testdata/recoded_sec_pyl.txt "+test.options, input)
+			if err != nil {
+				t.Error(err)
+			}
+			if want := test.expected; want != got {
+				t.Errorf("expected\n%s\nbut got\n%s\n", want, got)
+			}
+		})
+	}
+}
+
+func TestStats(t *testing.T) {
+
+	options := transeq.Options{
+		Optional: transeq.Optional{
+			Frame:     "F",
+			NumWorker: 1,
+		},
+	}
+	var stats bytes.Buffer
+	options.Stats = &stats
+
+	input := ">s1 c\nATGGCCTAAGGGTGA\n>s2\nNNNTAA\n>s3\n"
+	err := transeq.TranslateStream(strings.NewReader(input), ioutil.Discard, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "id\tlength\tgc\tstops_1\tstops_2\tstops_3\n" +
+		"s1\t15\t53.33\t2\t0\t0\n" +
+		"s2\t6\t0.00\t1\t0\t0\n" +
+		"s3\t0\t0.00\t0\t0\t0\n"
+	if got := stats.String(); got != want {
+		t.Errorf("expected\n%s\nbut got\n%s\n", want, got)
+	}
+}
+
+func TestTwoLetterCodons(t *testing.T) {
+
+	nucleotides := "ACGT"
+
+	// AA of the two letter codons AA, AC, AG, AT, CA, ..., TT. A two
+	// letter codon is translated only if the third letter doesn't change
+	// the AA: AGA and AGG are stops and ATA is M in table 2, but all AG
+	// codons are S in table 5
+	tests := []struct {
+		table    int
+		expected string
+	}{
+		{table: 0, expected: "XTXXXPRLXAGVXSXX"},
+		{table: 2, expected: "XTXXXPRLXAGVXSXX"},
+		{table: 5, expected: "XTSXXPRLXAGVXSXX"},
+		{table: 11, expected: "XTXXXPRLXAGVXSXX"},
+	}
+
+	for _, test := range tests {
+
+		var input, want bytes.Buffer
+		n := 0
+		for _, first := range nucleotides {
+			for _, second := range nucleotides {
+				prefix := string(first) + string(second)
+				fmt.Fprintf(&input, ">%s\nATG%s\n", prefix, prefix)
+				fmt.Fprintf(&want, ">%s_1\nM%c\n", prefix, test.expected[n])
+				n++
+			}
+		}
+
+		got, err := translateString(fmt.Sprintf("-table=%d", test.table), input.String())
+		if err != nil {
+			t.Error(err)
+		}
+		if got != want.String() {
+			t.Errorf("table %d: expected\n%s\nbut got\n%s\n", test.table, want.String(), got)
+		}
+	}
+
+	// a custom table without all the codons starting with 'TA' can't
+	// translate the two letter codon 'TA'
+	got, err := translateString("-table-file=testdata/partial_table.txt", ">s1\nTAATA\n")
+	if err != nil {
+		t.Error(err)
+	}
+	if want := ">s1_1\nQX\n"; got != want {
+		t.Errorf("expected\n%s\nbut got\n%s\n", want, got)
+	}
+}
+
+func TestIncompleteLastCodon(t *testing.T) {
+
+	tests := []struct {
+		name     string
+		sequence string
+		expected string
+	}{
+		// GCA, GCC, GCG and GCT are all Ala
+		{name: "ending in GC", sequence: "ATGGC", expected: "MA"},
+		{name: "ending in GN", sequence: "ATGGN", expected: "MX"},
+		{name: "ending in NC", sequence: "ATGNC", expected: "MX"},
+		{name: "N in third position", sequence: "ATGGCN", expected: "MA"},
+		{name: "ending in a single nucleotide", sequence: "ATGG", expected: "MX"},
+		// TAA and TAG are stops, but TAC and TAT are Tyr
+		{name: "ending in TA", sequence: "ATGTA", expected: "MX"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := translateString("-frame=1", ">s1\n"+test.sequence+"\n")
+			if err != nil {
+				t.Error(err)
+			}
+			if want := ">s1_1\n" + test.expected + "\n"; got != want {
+				t.Errorf("expected\n%s\nbut got\n%s\n", want, got)
+			}
+		})
+	}
+}
+
+func TestShortSequences(t *testing.T) {
+
+	// frames starting after the end of the sequence are empty
+	tests := []struct {
+		name     string
+		options  string
+		sequence string
+		expected string
+	}{
+		{name: "1 nucleotide", options: "-frame=F", sequence: "A", expected: ">s1_1\nX\n>s1_2\n>s1_3\n"},
+		{name: "2 nucleotides", options: "-frame=F", sequence: "AT", expected: ">s1_1\nX\n>s1_2\nX\n>s1_3\n"},
+		// CCA, CCC, CCG and CCT are all Pro
+		{name: "2 nucleotides with wobble", options: "-frame=F", sequence: "CC", expected: ">s1_1\nP\n>s1_2\nX\n>s1_3\n"},
+		{name: "1 nucleotide reverse", options: "-frame=R", sequence: "A", expected: ">s1_4\n>s1_5\nX\n>s1_6\n"},
+		{name: "2 nucleotides reverse", options: "-frame=R", sequence: "CC", expected: ">s1_4\n>s1_5\nX\n>s1_6\nG\n"},
+		{name: "alternative", options: "-frame=R -alternative", sequence: "CC", expected: ">s1_4\nG\n>s1_5\nX\n>s1_6\n"},
+		{name: "alternative start", options: "-frame=F -alternative-start", sequence: "AT", expected: ">s1_1\nX\n>s1_2\nX\n>s1_3\n"},
+		{name: "trim", options: "-frame=F -trim", sequence: "CC", expected: ">s1_1\nP\n>s1_2\n>s1_3\n"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := translateString(test.options, ">s1\n"+test.sequence+"\n")
+			if err != nil {
+				t.Error(err)
+			}
+			if want := test.expected; want != got {
+				t.Errorf("expected\n%s\nbut got\n%s\n", want, got)
+			}
+		})
+	}
+}
+
+func TestTableName(t *testing.T) {
+
+	input := ">s1\nATGAGATGAATA\n"
+
+	byCode, err := translateString("-table=2", input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	byName, err := translateString("-table-name=vertebrate-mitochondrial", input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := ">s1_1\nM*WM\n"; byCode != want || byName != want {
+		t.Errorf("expected\n%s\nbut got\n%s\nand\n%s\n", want, byCode, byName)
+	}
+
+	// the name overrides the code
+	got, err := translateString("-table=2 -table-name=standard", input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := ">s1_1\nMR*I\n"; got != want {
+		t.Errorf("expected\n%s\nbut got\n%s\n", want, got)
+	}
+
+	_, err = translateString("-table-name=unknown", input)
+	if err == nil || !strings.Contains(err.Error(), "unknown table name: unknown") {
+		t.Errorf("expected an error for an unknown table name, but got %v", err)
+	}
+}
+
+func TestTableFile(t *testing.T) {
+
+	input := ">s1\nATGTAACAATAG\n"
+
+	got, err := translateString("-table-file=testdata/taa_glutamine.txt", input)
+	if err != nil {
+		t.Error(err)
+	}
+	if want := ">s1_1\nMQQ*\n"; want != got {
+		t.Errorf("expected\n%s\nbut got\n%s\n", want, got)
+	}
+
+	_, err = translateString("-table-file=testdata/missing.txt", input)
+	if err == nil {
+		t.Errorf("expected an error for a missing table file")
+	}
+
+	_, err = translateString("-table-file=testdata/taa_glutamine.txt -alternative-start", input)
+	if err == nil || !strings.Contains(err.Error(), "--alternative-start can't be used with --table-file") {
+		t.Errorf("expected an error for --alternative-start with --table-file, but got %v", err)
+	}
+}
+
+func TestTranslateFiles(t *testing.T) {
+
+	options := transeq.Options{
+		Optional: transeq.Optional{
+			Frame:     "6",
+			NumWorker: 1,
+		},
+	}
+
+	var want bytes.Buffer
+	for _, filename := range []string{"testdata/test.fna", "testdata/test2.fna"} {
+		f, err := os.Open(filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = transeq.Translate(f, &want, options)
+		f.Close()
+		if err != nil {
+			t.Error(err)
+		}
+	}
+
+	var got bytes.Buffer
+	_, err := transeq.TranslateFiles([]string{"testdata/test.fna", "testdata/test2.fna"}, &got, options)
+	if err != nil {
+		t.Error(err)
+	}
+	if want.String() != got.String() {
+		t.Errorf("expected\n%s\nbut got\n%s\n", want.String(), got.String())
+	}
+	if !strings.Contains(got.String(), ">sequence1_1 first sequence\n") || !strings.Contains(got.String(), ">other1_1 from second file\n") {
+		t.Errorf("missing sequences from one of the files:\n%s", got.String())
+	}
+
+	_, err = transeq.TranslateFiles([]string{"testdata/test.fna", "testdata/missing.fna"}, ioutil.Discard, options)
+	if err == nil || !strings.Contains(err.Error(), "testdata/missing.fna") {
+		t.Errorf("expected an error naming the missing file, but got %v", err)
+	}
+}
+
+func TestTranslateFilesConcurrently(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "gotranseq")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	options := transeq.Options{
+		Optional: transeq.Optional{
+			Frame:     "6",
+			NumWorker: 1,
+		},
+	}
+
+	var filenames []string
+	var want bytes.Buffer
+	nbSequences := int64(0)
+	for i := 0; i < 16; i++ {
+		// files of different sizes, so they are not read in order
+		content := randomFasta(1+(i*7)%5, int64(i))
+		filename := filepath.Join(dir, fmt.Sprintf("input%d.fna", i))
+		if err := ioutil.WriteFile(filename, content, 0644); err != nil {
+			t.Fatal(err)
+		}
+		filenames = append(filenames, filename)
+		nbSequences += int64(bytes.Count(content, []byte{'>'}))
+
+		if err := transeq.Translate(bytes.NewReader(content), &want, options); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	options.NumWorker = 4
+	var got bytes.Buffer
+	summary, err := transeq.TranslateFiles(filenames, &got, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want.String() != got.String() {
+		compareByline(t, want.String(), got.String())
+	}
+	if summary.Sequences != nbSequences {
+		t.Errorf("expected %d sequences but got %d", nbSequences, summary.Sequences)
+	}
+	if want := 6 * nbSequences; summary.Frames != want {
+		t.Errorf("expected %d frames but got %d", want, summary.Frames)
+	}
+
+	// an error in one of the files stops the translation
+	filenames[5] = filepath.Join(dir, "missing.fna")
+	_, err = transeq.TranslateFiles(filenames, ioutil.Discard, options)
+	if err == nil || !strings.Contains(err.Error(), "missing.fna") {
+		t.Errorf("expected an error naming the missing file, but got %v", err)
+	}
+}
+
+func TestNumWorker(t *testing.T) {
+
+	for _, numWorker := range []int{0, -1} {
+		options := transeq.Options{Optional: transeq.Optional{Frame: "1", NumWorker: numWorker}}
+
+		err := transeq.TranslateStream(strings.NewReader(">s1\nATG\n"), ioutil.Discard, options)
+		if err == nil || !strings.Contains(err.Error(), "--numcpu") {
+			t.Errorf("expected an error for %d workers but got %v", numWorker, err)
+		}
+		_, err = transeq.ValidateFiles([]string{"testdata/test.fna"}, options)
+		if err == nil || !strings.Contains(err.Error(), "--numcpu") {
+			t.Errorf("expected an error for %d workers but got %v", numWorker, err)
+		}
+	}
+}
+
+func TestDefaultNumWorker(t *testing.T) {
+
+	defer os.Unsetenv("GOTRANSEQ_WORKERS")
+
+	os.Unsetenv("GOTRANSEQ_WORKERS")
+	if numWorker, err := transeq.DefaultNumWorker(); err != nil || numWorker != runtime.GOMAXPROCS(0) {
+		t.Errorf("expected %d workers without env var, but got %d, %v", runtime.GOMAXPROCS(0), numWorker, err)
+	}
+
+	os.Setenv("GOTRANSEQ_WORKERS", "3")
+	if numWorker, err := transeq.DefaultNumWorker(); err != nil || numWorker != 3 {
+		t.Errorf("expected 3 workers but got %d, %v", numWorker, err)
+	}
+
+	for _, value := range []string{"0", "-2", "four"} {
+		os.Setenv("GOTRANSEQ_WORKERS", value)
+		if _, err := transeq.DefaultNumWorker(); err == nil || !strings.Contains(err.Error(), "GOTRANSEQ_WORKERS") {
+			t.Errorf("expected an error for GOTRANSEQ_WORKERS=%s but got %v", value, err)
+		}
+	}
+}
+
+// a writer counting the calls to Write
+type writeCounter struct {
+	bytes.Buffer
+	writes int
+}
+
+func (w *writeCounter) Write(b []byte) (int, error) {
+	w.writes++
+	return w.Buffer.Write(b)
+}
+
+func TestFlushBytes(t *testing.T) {
+
+	input := randomFasta(50, 1)
+
+	tests := []struct {
+		name       string
+		flushBytes int
+		minWrites  int
+		maxWrites  int
+	}{
+		{name: "default", flushBytes: 0, minWrites: 1, maxWrites: 1},
+		{name: "small threshold", flushBytes: 1000, minWrites: 10, maxWrites: 50},
+		{name: "each sequence", flushBytes: 1, minWrites: 50, maxWrites: 50},
+	}
+
+	var want string
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			options := transeq.Options{
+				Optional: transeq.Optional{
+					Frame:      "6",
+					FlushBytes: test.flushBytes,
+					NumWorker:  2,
+				},
+			}
+			var out writeCounter
+			if err := transeq.TranslateStream(bytes.NewReader(input), &out, options); err != nil {
+				t.Fatal(err)
+			}
+			if out.writes < test.minWrites || out.writes > test.maxWrites {
+				t.Errorf("expected between %d and %d writes but got %d", test.minWrites, test.maxWrites, out.writes)
+			}
+			// the threshold doesn't change the output
+			if want == "" {
+				want = out.String()
+			} else if got := out.String(); got != want {
+				compareByline(t, want, got)
+			}
+		})
+	}
+
+	options := transeq.Options{Optional: transeq.Optional{FlushBytes: -1, NumWorker: 1}}
+	if err := transeq.TranslateStream(bytes.NewReader(input), ioutil.Discard, options); err == nil {
+		t.Errorf("expected an error for a negative --flush-bytes")
+	}
+}
+
+func TestCompressedInput(t *testing.T) {
+
+	options := transeq.Options{
+		Optional: transeq.Optional{
+			Frame:     "6",
+			NumWorker: 1,
+		},
+	}
+
+	var want bytes.Buffer
+	_, err := transeq.TranslateFiles([]string{"testdata/test.fna"}, &want, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// test_multistream.fna.gz is two gzip files concatenated
+	for _, filename := range []string{"testdata/test.fna.bz2", "testdata/test.fna.gz", "testdata/test_multistream.fna.gz"} {
+		t.Run(filename, func(t *testing.T) {
+			var got bytes.Buffer
+			_, err := transeq.TranslateFiles([]string{filename}, &got, options)
+			if err != nil {
+				t.Error(err)
+			}
+			if want.String() != got.String() {
+				t.Errorf("expected\n%s\nbut got\n%s\n", want.String(), got.String())
+			}
+		})
+	}
+}
+
+func TestFastq(t *testing.T) {
+
+	options := transeq.Options{
+		Optional: transeq.Optional{
+			Frame:     "1",
+			Fastq:     true,
+			NumWorker: 1,
+		},
+	}
+
+	var got bytes.Buffer
+	summary, err := transeq.TranslateFiles([]string{"testdata/reads.fastq"}, &got, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := ">read1_1 first read\nMA*G\n>read2_1\nFP\n"; want != got.String() {
+		t.Errorf("expected\n%s\nbut got\n%s\n", want, got.String())
+	}
+	if summary.Sequences != 2 {
+		t.Errorf("expected 2 sequences but got %d", summary.Sequences)
+	}
+
+	invalid := []struct {
+		name  string
+		input string
+		err   string
+	}{
+		{name: "fasta header", input: ">read1\nATG\n+\nIII\n", err: "line 1: fastq record should start with '@'"},
+		{name: "missing + line", input: "@read1\nATG\nIII\n", err: "line 3: expected a '+' line after the sequence of read1"},
+		{name: "missing quality line", input: "@read1\nATG\n+\n", err: "line 3: incomplete fastq record read1"},
+	}
+	for _, test := range invalid {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := translateString("-fastq", test.input)
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("expected error '%s' but got %v", test.err, err)
+			}
+		})
+	}
+}
+
+func TestTranslateFilesSplit(t *testing.T) {
+
+	options := transeq.Options{
+		Optional: transeq.Optional{
+			Frame:     "6",
+			NumWorker: 1,
+		},
+	}
+
+	outs := make([]io.Writer, 6)
+	bufs := make([]*bytes.Buffer, 6)
+	for i := range outs {
+		bufs[i] = bytes.NewBuffer(nil)
+		outs[i] = bufs[i]
+	}
+
+	_, err := transeq.TranslateFilesSplit([]string{"testdata/test2.fna"}, outs, options)
+	if err != nil {
+		t.Error(err)
+	}
+
+	expected := []string{
+		">other1_1 from second file\nMA*\n>other2_1\nFP\n",
+		">other1_2 from second file\nWRX\n>other2_2\nFP\n",
+		">other1_3 from second file\nGVX\n>other2_3\nSX\n",
+		">other1_4 from second file\nLRH\n>other2_4\nGK\n",
+		">other1_5 from second file\nTPX\n>other2_5\nEX\n",
+		">other1_6 from second file\nYAX\n>other2_6\nGX\n",
+	}
+	for i, want := range expected {
+		if got := bufs[i].String(); want != got {
+			t.Errorf("frame %d: expected\n%s\nbut got\n%s\n", i+1, want, got)
+		}
+	}
+
+	options.Frame = "F"
+	_, err = transeq.TranslateFilesSplit([]string{"testdata/test2.fna"}, make([]io.Writer, 6), options)
+	if err == nil {
+		t.Errorf("expected an error for missing writers")
+	}
+}
+
+func TestCRLF(t *testing.T) {
+
+	options := transeq.Options{
+		Optional: transeq.Optional{
+			Frame:     "6",
+			NumWorker: 1,
+		},
+	}
+
+	var want, got bytes.Buffer
+	_, err := transeq.TranslateFiles([]string{"testdata/test.fna"}, &want, options)
+	if err != nil {
+		t.Error(err)
+	}
+	_, err = transeq.TranslateFiles([]string{"testdata/test_crlf.fna"}, &got, options)
+	if err != nil {
+		t.Error(err)
+	}
+	if want.String() != got.String() {
+		t.Errorf("expected\n%s\nbut got\n%s\n", want.String(), got.String())
+	}
+}
+
+func TestURL(t *testing.T) {
+
+	server := httptest.NewServer(http.FileServer(http.Dir("testdata")))
+	defer server.Close()
+
+	options := transeq.Options{
+		Optional: transeq.Optional{
+			Frame:     "6",
+			NumWorker: 2,
+		},
+	}
+	var want bytes.Buffer
+	_, err := transeq.TranslateFiles([]string{"testdata/test.fna"}, &want, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// gzip is detected from the content
+	for _, name := range []string{"test.fna", "test.fna.gz", "test_multistream.fna.gz", "test.fna.bz2"} {
+		t.Run(name, func(t *testing.T) {
+			var got bytes.Buffer
+			_, err := transeq.TranslateFiles([]string{server.URL + "/" + name}, &got, options)
+			if err != nil {
+				t.Error(err)
+			}
+			if want.String() != got.String() {
+				t.Errorf("expected\n%s\nbut got\n%s\n", want.String(), got.String())
+			}
+		})
+	}
+
+	for _, test := range []struct {
+		url string
+		err string
+	}{
+		{url: server.URL + "/missing.fna", err: "fail to download " + server.URL + "/missing.fna: server returned 404 Not Found"},
+		{url: "s3://bucket/test.fna", err: "can't read s3://bucket/test.fna: unsupported URL scheme 's3'"},
+		{url: "http://127.0.0.1:0/test.fna", err: "127.0.0.1:0"},
+	} {
+		_, err := transeq.TranslateFiles([]string{test.url}, ioutil.Discard, options)
+		if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("expected error containing %s but got %v", test.err, err)
+		}
+	}
+}
+
+func TestURLStalled(t *testing.T) {
+
+	// the server stops sending before the headers, or in the middle
+	// of the body, until the client disconnects
+	stalled := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/body.fna" {
+			w.Write([]byte(">s1\nATG"))
+			w.(http.Flusher).Flush()
+		}
+		<-r.Context().Done()
+	}))
+	defer stalled.Close()
+
+	for _, name := range []string{"headers.fna", "body.fna"} {
+		t.Run(name, func(t *testing.T) {
+
+			options := transeq.Options{Optional: transeq.Optional{Frame: "1", NumWorker: 1, Timeout: 100 * time.Millisecond}}
+			_, err := transeq.TranslateFiles([]string{stalled.URL + "/" + name}, ioutil.Discard, options)
+			if err == nil || !strings.Contains(err.Error(), "translation timed out") {
+				t.Errorf("expected a timeout but got %v", err)
+			}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			time.AfterFunc(100*time.Millisecond, cancel)
+			options = transeq.Options{Optional: transeq.Optional{Frame: "1", NumWorker: 1}, Context: ctx}
+			_, err = transeq.TranslateFiles([]string{stalled.URL + "/" + name}, ioutil.Discard, options)
+			if err != transeq.ErrInterrupted {
+				t.Errorf("expected %v but got %v", transeq.ErrInterrupted, err)
+			}
+		})
+	}
+}
+
+func TestBOM(t *testing.T) {
+
+	options := transeq.Options{
+		Optional: transeq.Optional{
+			Frame:     "6",
+			NumWorker: 1,
+		},
+	}
+
+	var want, got bytes.Buffer
+	_, err := transeq.TranslateFiles([]string{"testdata/test.fna"}, &want, options)
+	if err != nil {
+		t.Error(err)
+	}
+	_, err = transeq.TranslateFiles([]string{"testdata/test_bom.fna"}, &got, options)
+	if err != nil {
+		t.Error(err)
+	}
+	if !strings.HasPrefix(got.String(), ">sequence1_1") {
+		t.Errorf("expected the first id to be 'sequence1' but got\n%s", got.String())
+	}
+	if want.String() != got.String() {
+		t.Errorf("expected\n%s\nbut got\n%s\n", want.String(), got.String())
+	}
+
+	// stdin and fastq files may also start with a BOM
+	out, err := translateString("-frame=1", "\xef\xbb\xbf>s1\nATGGCC\n")
+	if err != nil {
+		t.Error(err)
+	}
+	if want := ">s1_1\nMA\n"; out != want {
+		t.Errorf("expected\n%s\nbut got\n%s\n", want, out)
+	}
+	options.Fastq = true
+	options.Frame = "1"
+	got.Reset()
+	err = transeq.TranslateStream(strings.NewReader("\xef\xbb\xbf@r1\nATGGCC\n+\nIIIIII\n"), &got, options)
+	if err != nil {
+		t.Error(err)
+	}
+	if want := ">r1_1\nMA\n"; got.String() != want {
+		t.Errorf("expected\n%s\nbut got\n%s\n", want, got.String())
+	}
+}
+
+func TestLongLine(t *testing.T) {
+
+	nbCodons := 2 * 1024 * 1024
+	input := ">long\n" + strings.Repeat("ATG", nbCodons) + "\n"
+
+	got, err := translateString("-frame=1", input)
+	if err != nil {
+		t.Error(err)
+	}
+	if want, got := nbCodons, strings.Count(got, "M"); want != got {
+		t.Errorf("expected %d AA but got %d", want, got)
+	}
+	if !strings.HasPrefix(got, ">long_1\n"+strings.Repeat("M", 60)+"\n") {
+		t.Errorf("wrong output start: %s", got[:100])
+	}
+}
+
+func TestConcurrentWrites(t *testing.T) {
+
+	var input strings.Builder
+	for i := 0; i < 1000; i++ {
+		fmt.Fprintf(&input, ">seq%d comment %d\n%s\n", i, i, strings.Repeat("ATGCGTAAC", i%50+1))
+	}
+
+	want, err := translateString("-frame=6", input.String())
+	if err != nil {
+		t.Error(err)
+	}
+
+	options, err := getOptionsAndName("-frame=6")
+	if err != nil {
+		t.Error(err)
+	}
+	options.NumWorker = 4
+
+	got := bytes.NewBuffer(nil)
+	err = transeq.Translate(strings.NewReader(input.String()), got, options)
+	if err != nil {
+		t.Error(err)
+	}
+
+	wantRecords, gotRecords := parseRecords(want), parseRecords(got.String())
+	if len(wantRecords) != len(gotRecords) {
+		t.Errorf("expected %d records but got %d", len(wantRecords), len(gotRecords))
+	}
+	for id, sequence := range wantRecords {
+		if gotRecords[id] != sequence {
+			t.Errorf("record %s: expected\n%s\nbut got\n%s\n", id, sequence, gotRecords[id])
+		}
+	}
+}
+
+func TestOutputOrder(t *testing.T) {
+
+	var input, want strings.Builder
+	for i := 0; i < 100; i++ {
+		// make sequences of very different length, so workers
+		// finish in a different order
+		fmt.Fprintf(&input, ">seq%d\n%s\n", i, strings.Repeat("ATG", (100-i)*(100-i)))
+		fmt.Fprintf(&want, ">seq%d_1\n", i)
+	}
+
+	options, err := getOptionsAndName("-frame=1")
+	if err != nil {
+		t.Error(err)
+	}
+	options.NumWorker = 8
+
+	out := bytes.NewBuffer(nil)
+	err = transeq.Translate(strings.NewReader(input.String()), out, options)
+	if err != nil {
+		t.Error(err)
+	}
+
+	var got strings.Builder
+	for _, line := range strings.Split(out.String(), "\n") {
+		if strings.HasPrefix(line, ">") {
+			got.WriteString(line + "\n")
+		}
+	}
+	if want.String() != got.String() {
+		t.Errorf("expected sequences in order\n%s\nbut got\n%s\n", want.String(), got.String())
+	}
+}
+
+func TestFrameList(t *testing.T) {
+
+	input := ">s1\nATGGCGTAA\n"
+
+	tests := []struct {
+		frame    string
+		expected string
+		err      string
+	}{
+		{
+			frame:    "1,-1",
+			expected: ">s1_1\nMA*\n>s1_4\nLRH\n",
+		},
+		{
+			frame:    "2,3",
+			expected: ">s1_2\nWRX\n>s1_3\nGVX\n",
+		},
+		{
+			frame:    "-1,1",
+			expected: ">s1_1\nMA*\n>s1_4\nLRH\n",
+		},
+		{
+			frame:    "1..2",
+			expected: ">s1_1\nMA*\n>s1_2\nWRX\n",
+		},
+		{
+			frame:    "-3..3",
+			expected: ">s1_1\nMA*\n>s1_2\nWRX\n>s1_3\nGVX\n>s1_4\nLRH\n>s1_5\nTPX\n>s1_6\nYAX\n",
+		},
+		{
+			frame:    "-1..-1,2",
+			expected: ">s1_2\nWRX\n>s1_4\nLRH\n",
+		},
+		{
+			frame: "3..1",
+			err:   "invalid frame range '3..1'",
+		},
+		{
+			frame: "1,0..4",
+			err:   "invalid frame '0..4'",
+		},
+		{
+			frame: "1,9",
+			err:   "invalid frame '9'",
+		},
+		{
+			frame: "1,",
+			err:   "invalid frame ''",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.frame, func(t *testing.T) {
+			got, err := translateString("-frame="+test.frame, input)
+			if test.err != "" {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Errorf("expected error containing %s but got %v", test.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Error(err)
+			}
+			if want := test.expected; want != got {
+				t.Errorf("expected\n%s\nbut got\n%s\n", want, got)
+			}
+		})
+	}
+}
+
+// parseRecords returns a map of header <-> sequence of a fasta string
+func parseRecords(fasta string) map[string]string {
+
+	records := map[string]string{}
+	for _, record := range strings.Split(fasta, ">")[1:] {
+		lines := strings.SplitN(record, "\n", 2)
+		records[lines[0]] = lines[1]
+	}
+	return records
+}
+
+func TestSummary(t *testing.T) {
+
+	tests := []struct {
+		frame      string
+		trim       bool
+		frames     int64
+		aminoAcids int64
+		alphabet   string
+	}{
+		{frame: "6", frames: 12, aminoAcids: 30, alphabet: "*AEFGHKLMPRSTVWXY"},
+		{frame: "1", frames: 2, aminoAcids: 5, alphabet: "*AFMP"},
+		// trailing 'X' and '*' are not counted
+		{frame: "6", trim: true, frames: 12, aminoAcids: 22, alphabet: "AEFGHKLMPRSTVWY"},
+	}
+
+	for _, test := range tests {
+		options := transeq.Options{
+			Optional: transeq.Optional{
+				Frame:     test.frame,
+				Trim:      test.trim,
+				NumWorker: 2,
+			},
+		}
+		summary, err := transeq.TranslateFiles([]string{"testdata/test2.fna"}, ioutil.Discard, options)
+		if err != nil {
+			t.Error(err)
+		}
+		if summary.Sequences != 2 || summary.Frames != test.frames || summary.AminoAcids != test.aminoAcids {
+			t.Errorf("frame %s: expected 2 sequences, %d frames, %d AA, but got %+v", test.frame, test.frames, test.aminoAcids, summary)
+		}
+		if summary.Alphabet != test.alphabet {
+			t.Errorf("frame %s: expected AA %s but got %s", test.frame, test.alphabet, summary.Alphabet)
+		}
+		if summary.Nucleotides != 15 {
+			t.Errorf("frame %s: expected 15 nucleotides but got %d", test.frame, summary.Nucleotides)
+		}
+	}
+
+	// nucleotides are counted once per sequence, whatever the nb of threads
+	input, err := ioutil.ReadFile("testdata/test.fna")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var want int64
+	for _, line := range bytes.Split(input, []byte("\n")) {
+		if len(line) > 0 && line[0] != '>' {
+			want += int64(len(line))
+		}
+	}
+	for _, numWorker := range []int{1, 4} {
+		options := transeq.Options{Optional: transeq.Optional{Frame: "6", NumWorker: numWorker}}
+		summary, err := transeq.TranslateFiles([]string{"testdata/test.fna", "testdata/test.fna"}, ioutil.Discard, options)
+		if err != nil {
+			t.Error(err)
+		}
+		if summary.Nucleotides != 2*want {
+			t.Errorf("%d threads: expected %d nucleotides but got %d", numWorker, 2*want, summary.Nucleotides)
+		}
+	}
+}
+
+func TestCheckIDs(t *testing.T) {
+
+	input := ">seq1 first\nATG\n>seq2\nATG\n>seq1 second\nATG\n"
+
+	_, err := translateString("-check-ids", input)
+	if err == nil || !strings.Contains(err.Error(), "duplicate sequence id: seq1") {
+		t.Errorf("expected a duplicate id error but got %v", err)
+	}
+
+	// duplicates are allowed by default
+	got, err := translateString("-frame=1", input)
+	if err != nil {
+		t.Error(err)
+	}
+	if want := ">seq1_1 first\nM\n>seq2_1\nM\n>seq1_1 second\nM\n"; want != got {
+		t.Errorf("expected\n%s\nbut got\n%s\n", want, got)
+	}
+
+	_, err = translateString("-check-ids", ">seq1\nATG\n>seq11\nATG\n")
+	if err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestFirstN(t *testing.T) {
+
+	tests := []struct {
+		name     string
+		files    []string
+		firstN   int
+		skip     int
+		expected []string
+	}{
+		{
+			name:     "first sequences of a file",
+			files:    []string{"testdata/test.fna"},
+			firstN:   4,
+			expected: []string{">sequence1_1 first sequence", ">sequence2_1 second sequence", ">sequence3_1", ">sequence4_1"},
+		},
+		{
+			name:     "on several files",
+			files:    []string{"testdata/test2.fna", "testdata/test.fna", "testdata/test2.fna"},
+			firstN:   3,
+			expected: []string{">other1_1 from second file", ">other2_1", ">sequence1_1 first sequence"},
+		},
+		{
+			name:     "more than the nb of sequences",
+			files:    []string{"testdata/test2.fna"},
+			firstN:   10,
+			expected: []string{">other1_1 from second file", ">other2_1"},
+		},
+		{
+			name:     "skip",
+			files:    []string{"testdata/test.fna"},
+			skip:     9,
+			expected: []string{">sequence11_1", ">sequence12_1 sequence with unknown nucl"},
+		},
+		{
+			name:     "window on several files",
+			files:    []string{"testdata/test2.fna", "testdata/test.fna", "testdata/test2.fna"},
+			skip:     1,
+			firstN:   3,
+			expected: []string{">other2_1", ">sequence1_1 first sequence", ">sequence2_1 second sequence"},
+		},
+		{
+			name:     "window on the last file",
+			files:    []string{"testdata/test.fna", "testdata/test2.fna"},
+			skip:     11,
+			firstN:   1,
+			expected: []string{">other1_1 from second file"},
+		},
+		{
+			name:   "skip all",
+			files:  []string{"testdata/test2.fna"},
+			skip:   2,
+			firstN: 1,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			options := transeq.Options{Optional: transeq.Optional{Frame: "1", FirstN: test.firstN, Skip: test.skip, NumWorker: 4}}
+			var out bytes.Buffer
+			summary, err := transeq.TranslateFiles(test.files, &out, options)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if summary.Sequences != int64(len(test.expected)) {
+				t.Errorf("expected %d sequences but got %d", len(test.expected), summary.Sequences)
+			}
+			var headers []string
+			for _, line := range strings.Split(out.String(), "\n") {
+				if strings.HasPrefix(line, ">") {
+					headers = append(headers, line)
+				}
+			}
+			if strings.Join(headers, "\n") != strings.Join(test.expected, "\n") {
+				t.Errorf("expected headers\n%s\nbut got\n%s\n", strings.Join(test.expected, "\n"), strings.Join(headers, "\n"))
+			}
+		})
+	}
+
+	for _, param := range []string{"first-n", "skip"} {
+		_, err := translateString("-"+param+"=-1", ">s1\nATG\n")
+		if err == nil || !strings.Contains(err.Error(), "wrong value for --"+param+" parameter: -1") {
+			t.Errorf("expected an error for a negative value of %s but got %v", param, err)
+		}
+	}
+}
+
+func TestSubsample(t *testing.T) {
+
+	fasta := randomFasta(1000, 1)
+
+	subsample := func(seed int64, numWorker int) []string {
+		options := transeq.Options{Optional: transeq.Optional{Frame: "1", Subsample: 0.1, Seed: &seed, NumWorker: numWorker}}
+		var out bytes.Buffer
+		if err := transeq.TranslateStream(bytes.NewReader(fasta), &out, options); err != nil {
+			t.Fatal(err)
+		}
+		var headers []string
+		for _, line := range strings.Split(out.String(), "\n") {
+			if strings.HasPrefix(line, ">") {
+				headers = append(headers, line)
+			}
+		}
+		return headers
+	}
+
+	selected := subsample(42, 1)
+	if len(selected) < 50 || len(selected) > 150 {
+		t.Errorf("expected about 100 sequences out of 1000 but got %d", len(selected))
+	}
+	if again := strings.Join(subsample(42, 4), "\n"); again != strings.Join(selected, "\n") {
+		t.Errorf("expected the same sequences with the same seed but got\n%s\nand\n%s", strings.Join(selected, "\n"), again)
+	}
+	if other := strings.Join(subsample(43, 4), "\n"); other == strings.Join(selected, "\n") {
+		t.Errorf("expected different sequences with another seed")
+	}
+	// 0 is a seed like any other
+	if zero := strings.Join(subsample(0, 1), "\n"); zero != strings.Join(subsample(0, 4), "\n") {
+		t.Errorf("expected the same sequences with seed 0")
+	}
+	zero, err := translateString("-frame=1 -subsample=0.5 -seed=0", string(fasta))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again, _ := translateString("-frame=1 -subsample=0.5 -seed=0", string(fasta)); again != zero {
+		t.Errorf("expected the same sequences with --seed 0")
+	}
+
+	for _, value := range []string{"-0.5", "1.5"} {
+		_, err := translateString("-subsample="+value, ">s1\nATG\n")
+		if err == nil || !strings.Contains(err.Error(), "wrong value for --subsample parameter: "+value) {
+			t.Errorf("expected an error for --subsample=%s but got %v", value, err)
+		}
+	}
+}
+
+func TestSelectID(t *testing.T) {
+
+	input := ">seq1 first\nATGGCC\n>seq12\nTTTCCC\n>seq2\nATG\nAAA\n>other\nATG\n"
+
+	tests := []struct {
+		name     string
+		options  string
+		input    string
+		expected string
+	}{
+		{name: "exact id", options: "-frame=1 -id=seq2", expected: ">seq2_1\nMK\n"},
+		{name: "prefix of another id", options: "-frame=1 -id=seq1", expected: ">seq1_1 first\nMA\n"},
+		{name: "id prefix", options: "-frame=1 -id=seq1 -id-prefix", expected: ">seq1_1 first\nMA\n>seq12_1\nFP\n"},
+		{name: "no match", options: "-frame=1 -id=seq3", expected: ""},
+		{
+			name:     "fastq",
+			options:  "-frame=1 -fastq -id=r2",
+			input:    "@r1\nATGGCC\n+\nIIIIII\n@r2\nTTTCCC\n+\n@IIIII\n",
+			expected: ">r2_1\nFP\n",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if test.input == "" {
+				test.input = input
+			}
+			got, err := translateString(test.options, test.input)
+			if err != nil {
+				t.Error(err)
+			}
+			if want := test.expected; want != got {
+				t.Errorf("expected\n%s\nbut got\n%s\n", want, got)
+			}
+		})
+	}
+
+	// only the selected sequence is read
+	options := transeq.Options{Optional: transeq.Optional{Frame: "1", ID: "other", NumWorker: 1}}
+	summary, err := transeq.TranslateFiles([]string{"testdata/test.fna"}, ioutil.Discard, options)
+	if err != nil {
+		t.Error(err)
+	}
+	if summary.Sequences != 0 {
+		t.Errorf("expected no sequence but got %d", summary.Sequences)
+	}
+}
+
+func TestDedup(t *testing.T) {
+
+	input, err := ioutil.ReadFile("testdata/duplicates.fna")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		options  string
+		input    string
+		expected string
+	}{
+		{
+			name:     "frame 1",
+			options:  "-frame=1 -dedup",
+			expected: ">s1_1 dups=1\nMA\n>s3_1\nFP\n",
+		},
+		{
+			name:     "reverse frames differ",
+			options:  "-frame=1,-1 -dedup",
+			expected: ">s1_1 dups=1\nMA\n>s1_4\nGH\n>s2_4 same protein\nSH\n>s3_1\nFP\n>s3_4\nGK\n",
+		},
+		{
+			name:     "orf",
+			options:  "-frame=1 -orf=1 -dedup",
+			input:    ">a\nATGGCCTAA\n>b\nATGGCTTGA\n",
+			expected: ">a_1_1 [1 - 9] dups=1\nMA\n",
+		},
+		{
+			name:     "tsv",
+			options:  "-frame=1 -format=tsv -dedup",
+			expected: "s1\t1\t2\tMA\ns3\t1\t2\tFP\n",
+		},
+		{
+			name:     "sort by length",
+			options:  "-frame=1 -dedup -sort-by-length",
+			input:    ">a\nATGGCC\n>b\nATGGCCTTT\n>c\nATGGCT\n",
+			expected: ">b_1\nMAF\n>a_1 dups=1\nMA\n",
+		},
+		{
+			name:     "without dedup",
+			options:  "-frame=1",
+			expected: ">s1_1\nMA\n>s2_1 same protein\nMA\n>s3_1\nFP\n",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if test.input == "" {
+				test.input = string(input)
+			}
+			got, err := translateString(test.options, test.input)
+			if err != nil {
+				t.Error(err)
+			}
+			if want := test.expected; want != got {
+				compareByline(t, want, got)
+			}
+		})
+	}
+
+	options := transeq.Options{Optional: transeq.Optional{Frame: "1", Dedup: true, NumWorker: 2}}
+	summary, err := transeq.TranslateFiles([]string{"testdata/duplicates.fna"}, ioutil.Discard, options)
+	if err != nil {
+		t.Error(err)
+	}
+	if summary.Frames != 2 || summary.Duplicates != 1 || summary.AminoAcids != 4 || summary.Alphabet != "AFMP" {
+		t.Errorf("expected 2 frames, 4 AA and 1 duplicate, but got %+v", summary)
+	}
+
+	// the AA of the duplicates are not counted, whatever the
+	// characters of the stops and of the unknown codons
+	var composition bytes.Buffer
+	options = transeq.Options{Optional: transeq.Optional{Frame: "1", Dedup: true, StopChar: ".", UnknownChar: "-", NumWorker: 1}, Composition: &composition}
+	var out bytes.Buffer
+	err = transeq.Translate(strings.NewReader(">a\nATGTGANNN\n>b\nATGTAANNN\n>c\nTTT\n"), &out, options)
+	if err != nil {
+		t.Error(err)
+	}
+	if want, got := ">a_1 dups=1\nM.-\n>c_1\nF\n", out.String(); want != got {
+		compareByline(t, want, got)
+	}
+	for _, line := range strings.Split(strings.TrimSuffix(composition.String(), "\n"), "\n")[1:] {
+		switch line[:1] {
+		case "M", "*", "X", "F":
+			if !strings.HasSuffix(line, "\t1\t0.2500") {
+				t.Errorf("expected 1 occurrence of %s but got '%s'", line[:1], line)
+			}
+		default:
+			if !strings.HasSuffix(line, "\t0\t0.0000") {
+				t.Errorf("expected no occurrence of %s but got '%s'", line[:1], line)
+			}
+		}
+	}
+
+	// the lines of the duplicated ORFs are not written to the BED file
+	var bed bytes.Buffer
+	options = transeq.Options{Optional: transeq.Optional{Frame: "1", ORF: 1, Dedup: true, NumWorker: 1}, BED: &bed}
+	err = transeq.Translate(strings.NewReader(">a\nATGGCCTAA\n>b\nATGGCTTGA\n>c\nATGTTTTAA\n"), ioutil.Discard, options)
+	if err != nil {
+		t.Error(err)
+	}
+	if want, got := "a\t0\t9\ta_1_1\t0\t+\nc\t0\t9\tc_1_1\t0\t+\n", bed.String(); want != got {
+		compareByline(t, want, got)
+	}
+}
+
+func TestDedupWorkers(t *testing.T) {
+
+	// many sequences with a few distinct proteins, so the workers
+	// translate duplicates of the same protein at the same time
+	var input strings.Builder
+	codons := []string{"GCC", "GCT", "TTT", "TTC"}
+	for i := 0; i < 2000; i++ {
+		fmt.Fprintf(&input, ">s%d\nATG%s%s\n", i, codons[i%4], codons[(i/4)%4])
+	}
+	dir, err := ioutil.TempDir("", "gotranseq")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "duplicates.fna")
+	if err := ioutil.WriteFile(filename, []byte(input.String()), 0644); err != nil {
+		t.Fatal(err)
+	}
+	options := transeq.Options{Optional: transeq.Optional{Frame: "1", Dedup: true, NumWorker: 1}}
+
+	var want bytes.Buffer
+	wantSummary, err := transeq.TranslateFiles([]string{filename}, &want, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := ">s0_1 dups=499\nMAA\n>s2_1 dups=499\nMFA\n>s8_1 dups=499\nMAF\n>s10_1 dups=499\nMFF\n"; want.String() != expected {
+		compareByline(t, expected, want.String())
+	}
+
+	options.NumWorker = 4
+	for i := 0; i < 20; i++ {
+		var got bytes.Buffer
+		summary, err := transeq.TranslateFiles([]string{filename}, &got, options)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want.String() != got.String() {
+			compareByline(t, want.String(), got.String())
+		}
+		if summary.Frames != 4 || summary.Duplicates != 1996 || summary.AminoAcids != wantSummary.AminoAcids || summary.AminoAcids != 12 {
+			t.Errorf("expected 4 frames, 12 AA and 1996 duplicates, but got %+v", summary)
+		}
+	}
+}
+
+func TestRegion(t *testing.T) {
+
+	sequence := "CCACACCACACCCACACACCCACACACCACACCACACACCACACCACACCCACACACACA"
+
+	tests := []struct {
+		region string
+		start  int
+		end    int
+	}{
+		{region: "1-60", start: 1, end: 60},
+		{region: "10-40", start: 10, end: 40},
+		{region: "11-41", start: 11, end: 41},
+		{region: "2-2", start: 2, end: 2},
+		// out of range regions are clamped
+		{region: "30-1000", start: 30, end: 60},
+		{region: "100-1000", start: 61, end: 60},
+	}
+
+	for _, test := range tests {
+		t.Run(test.region, func(t *testing.T) {
+
+			want, err := translateString("-frame=6", ">s1\n"+sequence[test.start-1:test.end]+"\n")
+			if err != nil {
+				t.Error(err)
+			}
+			got, err := translateString("-frame=6 -region="+test.region, ">s1\n"+sequence+"\n")
+			if err != nil {
+				t.Error(err)
+			}
+			if want != got {
+				t.Errorf("expected\n%s\nbut got\n%s\n", want, got)
+			}
+		})
+	}
+
+	for _, region := range []string{"0-10", "10-5", "10", "a-b", "-10"} {
+		_, err := translateString("-region="+region, ">s1\n"+sequence+"\n")
+		if err == nil {
+			t.Errorf("expected an error for region %s", region)
+		}
+	}
+}
+
+func TestThreeLetter(t *testing.T) {
+
+	tests := []struct {
+		name     string
+		options  string
+		input    string
+		expected string
+	}{
+		{
+			name:     "simple",
+			options:  "-three-letter",
+			input:    ">s1\nATGGCGCGTTAA\n",
+			expected: ">s1_1\nMet Ala Arg Stop\n",
+		},
+		{
+			name:     "unknown",
+			options:  "-three-letter",
+			input:    ">s1\nATGNNNAT\n",
+			expected: ">s1_1\nMet Xaa Xaa\n",
+		},
+		{
+			name:     "trim",
+			options:  "-three-letter -trim",
+			input:    ">s1\nATGGCGTAANNN\n",
+			expected: ">s1_1\nMet Ala\n",
+		},
+		{
+			name:     "custom stop char",
+			options:  "-three-letter -stopchar=.",
+			input:    ">s1\nATGTAA\n",
+			expected: ">s1_1\nMet Stop\n",
+		},
+		{
+			name:     "line wrapping",
+			options:  "-three-letter",
+			input:    ">s1\n" + strings.Repeat("ATG", 21) + "\n",
+			expected: ">s1_1\n" + strings.Repeat("Met ", 19) + "Met\nMet\n",
+		},
+		{
+			name:     "trim on a new line",
+			options:  "-three-letter -trim",
+			input:    ">s1\n" + strings.Repeat("ATG", 20) + "TAATAA\n",
+			expected: ">s1_1\n" + strings.Repeat("Met ", 19) + "Met\n",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := translateString(test.options, test.input)
+			if err != nil {
+				t.Error(err)
+			}
+			if want := test.expected; want != got {
+				t.Errorf("expected\n%s\nbut got\n%s\n", want, got)
+			}
+		})
+	}
+}
+
+func TestLineWidth(t *testing.T) {
+
+	input := ">s1\nATGGCCAAATTTCCCGGG\n"
+
+	tests := []struct {
+		name     string
+		options  string
+		expected string
+		err      string
+	}{
+		{
+			name:     "custom line width",
+			options:  "-line-width=4",
+			expected: ">s1_1\nMAKF\nPG\n",
+		},
+		{
+			name:     "three-letter",
+			options:  "-line-width=2 -three-letter",
+			expected: ">s1_1\nMet Ala\nLys Phe\nPro Gly\n",
+		},
+		{
+			name:     "custom frame suffixes",
+			options:  "-frame=1,-1 -frame-suffixes=1,2,3,r1,r2,r3",
+			expected: ">s1_1\nMAKFPG\n>s1_r1\nPGKFGH\n",
+		},
+		{
+			name:    "negative line width",
+			options: "-line-width=-1",
+			err:     "wrong value for --line-width parameter: -1, must be positive",
+		},
+		{
+			name:    "wrong nb of suffixes",
+			options: "-frame-suffixes=a,b",
+			err:     "wrong value for --frame-suffixes parameter: 'a,b', must be 6 suffixes separated by commas",
+		},
+		{
+			name:    "empty suffix",
+			options: "-frame-suffixes=1,2,3,,5,6",
+			err:     "wrong value for --frame-suffixes parameter: '1,2,3,,5,6', suffixes can't be empty",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := translateString(test.options, input)
+			if test.err != "" {
+				if err == nil || err.Error() != test.err {
+					t.Errorf("expected error '%s' but got %v", test.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Error(err)
+			}
+			if want := test.expected; want != got {
+				t.Errorf("expected\n%s\nbut got\n%s\n", want, got)
+			}
+		})
+	}
+}
+
+// translateString translates a fasta string with options formatted like
+// in testdata/data.json, using a single worker
+func TestORF(t *testing.T) {
+
+	tests := []struct {
+		name     string
+		opts     string
+		sequence string
+		expected string
+	}{
+		{
+			name:     "forward frames",
+			opts:     "-frame=6 -orf=1",
+			sequence: "CCATGAAATTTTAGCCATGCCCTAA",
+			expected: ">s1_2_1 [17 - 25] c\nMP\n>s1_3_1 [3 - 14] c\nMKF\n",
+		},
+		{
+			name:     "min length",
+			opts:     "-frame=6 -orf=3",
+			sequence: "CCATGAAATTTTAGCCATGCCCTAA",
+			expected: ">s1_3_1 [3 - 14] c\nMKF\n",
+		},
+		{
+			name:     "reverse frame",
+			opts:     "-frame=-1 -orf=1",
+			sequence: "TTAGGGCAT",
+			expected: ">s1_4_1 [9 - 1] c\nMP\n",
+		},
+		{
+			name:     "several ORFs in a frame",
+			opts:     "-frame=1 -orf=1",
+			sequence: "ATGTAAATGATGCCCTGAAAA",
+			expected: ">s1_1_1 [1 - 6] c\nM\n>s1_1_2 [7 - 18] c\nMMP\n",
+		},
+		{
+			name:     "no stop codon",
+			opts:     "-frame=1 -orf=1",
+			sequence: "ATGCCCAAA",
+			expected: "",
+		},
+		{
+			name:     "clean",
+			opts:     "-frame=1 -orf=1 -clean",
+			sequence: "ATGCCCTAA",
+			expected: ">s1_1_1 [1 - 9] c\nMP\n",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := translateString(test.opts, ">s1 c\n"+test.sequence+"\n")
+			if err != nil {
+				t.Error(err)
+			}
+			if got != test.expected {
+				t.Errorf("expected\n%s\nbut got\n%s\n", test.expected, got)
+			}
+		})
+	}
+}
+
+func TestBED(t *testing.T) {
+
+	// an ORF in frame 1 on positions 1 to 9, and in frame -1
+	// on positions 24 to 13 of the forward sequence
+	input := ">s1 comment\nATGGCCTAACCCTTACATCATCAT\n>s2\nCCC\n"
+
+	options := transeq.Options{
+		Optional: transeq.Optional{
+			Frame:     "1,-1",
+			ORF:       1,
+			NumWorker: 2,
+		},
+	}
+	var bed bytes.Buffer
+	options.BED = &bed
+
+	var out bytes.Buffer
+	if err := transeq.TranslateStream(strings.NewReader(input), &out, options); err != nil {
+		t.Fatal(err)
+	}
+	if want := ">s1_1_1 [1 - 9] comment\nMA\n>s1_4_1 [24 - 13] comment\nMMM\n"; out.String() != want {
+		t.Errorf("expected\n%s\nbut got\n%s\n", want, out.String())
+	}
+	if want := "s1\t0\t9\ts1_1_1\t0\t+\ns1\t12\t24\ts1_4_1\t0\t-\n"; bed.String() != want {
+		t.Errorf("expected\n%s\nbut got\n%s\n", want, bed.String())
+	}
+
+	options.ORF = 0
+	err := transeq.TranslateStream(strings.NewReader(input), ioutil.Discard, options)
+	if err == nil || !strings.Contains(err.Error(), "--bed can only be used with --orf") {
+		t.Errorf("expected an error without --orf but got %v", err)
+	}
+}
+
+func TestGFF(t *testing.T) {
+
+	// an ORF in frame 1 on positions 1 to 9, and in frame -1
+	// on positions 24 to 13 of the forward sequence
+	input := ">s1 comment\nATGGCCTAACCCTTACATCATCAT\n>s2\nCCC\n"
+
+	options := transeq.Options{
+		Optional: transeq.Optional{
+			Frame:     "1,-1",
+			ORF:       1,
+			NumWorker: 2,
+		},
+	}
+	var gff bytes.Buffer
+	options.GFF = &gff
+
+	var out bytes.Buffer
+	if err := transeq.TranslateStream(strings.NewReader(input), &out, options); err != nil {
+		t.Fatal(err)
+	}
+	if want := ">s1_1_1 [1 - 9] comment\nMA\n>s1_4_1 [24 - 13] comment\nMMM\n"; out.String() != want {
+		t.Errorf("expected\n%s\nbut got\n%s\n", want, out.String())
+	}
+	want := "##gff-version 3\n" +
+		"s1\tgotranseq\tCDS\t1\t9\t.\t+\t0\tID=s1_1_1\n" +
+		"s1\tgotranseq\tCDS\t13\t24\t.\t-\t0\tID=s1_4_1\n"
+	if gff.String() != want {
+		t.Errorf("expected\n%s\nbut got\n%s\n", want, gff.String())
+	}
+
+	options.ORF = 0
+	err := transeq.TranslateStream(strings.NewReader(input), ioutil.Discard, options)
+	if err == nil || !strings.Contains(err.Error(), "--gff can only be used with --orf") {
+		t.Errorf("expected an error without --orf but got %v", err)
+	}
+}
+
+func TestReverseCoords(t *testing.T) {
+
+	// reverse-complement of ATGGCCAAATTT is AAATTTGGCCAT
+	input := ">s1 c\nATGGCCAAATTT\n>s2\nATGGCCAAATT\n"
+
+	tests := []struct {
+		name     string
+		opts     string
+		expected string
+	}{
+		{
+			name:     "frames -1 and -3",
+			opts:     "-frame=-1,-3 -reverse-coords",
+			expected: ">s1_4 [12 - 1] c\nKFGH\n>s1_6 [11 - 1] c\nNLAX\n>s2_4 [9 - 1]\nFGH\n>s2_6 [11 - 1]\nNLAX\n",
+		},
+		{
+			name:     "forward frames are not annotated",
+			opts:     "-frame=1,-1 -reverse-coords",
+			expected: ">s1_1 c\nMAKF\n>s1_4 [12 - 1] c\nKFGH\n>s2_1\nMAKX\n>s2_4 [9 - 1]\nFGH\n",
+		},
+		{
+			name:     "trimmed frame",
+			opts:     "-frame=-3 -reverse-coords -trim",
+			expected: ">s1_6 [11 - 3] c\nNLA\n>s2_6 [11 - 3]\nNLA\n",
+		},
+		{
+			name:     "jsonl",
+			opts:     "-frame=-1 -reverse-coords -format=jsonl",
+			expected: `{"id":"s1","frame":4,"comment":"c","protein":"KFGH","begin":12,"end":1}` + "\n" + `{"id":"s2","frame":4,"comment":"","protein":"FGH","begin":9,"end":1}` + "\n",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := translateString(test.opts, input)
+			if err != nil {
+				t.Error(err)
+			}
+			if got != test.expected {
+				t.Errorf("expected\n%s\nbut got\n%s\n", test.expected, got)
+			}
+		})
+	}
+}
+
+func TestMinProteinLen(t *testing.T) {
+
+	input := ">s1\nATGGCCAAATTT\n>s2\nATGTAA\n>s3\nATGGCCTAANNN\n"
+
+	tests := []struct {
+		name     string
+		opts     string
+		input    string
+		expected string
+		err      bool
+	}{
+		{
+			name:     "short frames dropped",
+			opts:     "-frame=1 -min-protein-len=3",
+			input:    input,
+			expected: ">s1_1\nMAKF\n>s3_1\nMA*X\n",
+		},
+		{
+			name:     "length after trim",
+			opts:     "-frame=1 -min-protein-len=3 -trim",
+			input:    input,
+			expected: ">s1_1\nMAKF\n",
+		},
+		{
+			name:     "all frames kept",
+			opts:     "-frame=1 -min-protein-len=2",
+			input:    input,
+			expected: ">s1_1\nMAKF\n>s2_1\nM*\n>s3_1\nMA*X\n",
+		},
+		{
+			name:     "orf",
+			opts:     "-frame=1 -orf=1 -min-protein-len=2",
+			input:    ">s1\nATGTAAATGATGCCCTGAAAA\n",
+			expected: ">s1_1_2 [7 - 18]\nMMP\n",
+		},
+		{
+			name:  "negative length",
+			opts:  "-min-protein-len=-1",
+			input: input,
+			err:   true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := translateString(test.opts, test.input)
+			if test.err {
+				if err == nil {
+					t.Errorf("expected an error but got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Error(err)
+			}
+			if got != test.expected {
+				t.Errorf("expected\n%s\nbut got\n%s\n", test.expected, got)
+			}
+		})
+	}
+}
+
+func TestMaskLowComplexity(t *testing.T) {
+
+	// a poly-Q run of 6 CAG
+	input := ">s1\nATGCAGCAGCAGCAGCAGCAGGCCGCCTAAAAAAAATAG\n"
+
+	tests := []struct {
+		name     string
+		options  string
+		expected string
+		err      string
+	}{
+		{name: "no masking", options: "-frame=1", expected: ">s1_1\nMQQQQQQAA*KK*\n"},
+		{name: "poly-Q masked", options: "-frame=1 -mask-lowcomplexity=5", expected: ">s1_1\nMXXXXXXAA*KK*\n"},
+		{name: "run of threshold length", options: "-frame=1 -mask-lowcomplexity=6", expected: ">s1_1\nMXXXXXXAA*KK*\n"},
+		{name: "run too short", options: "-frame=1 -mask-lowcomplexity=7", expected: ">s1_1\nMQQQQQQAA*KK*\n"},
+		{name: "stops are kept", options: "-frame=1 -mask-lowcomplexity=2", expected: ">s1_1\nMXXXXXXXX*XX*\n"},
+		{name: "orf", options: "-frame=1 -orf=1 -mask-lowcomplexity=5", expected: ">s1_1_1 [1 - 30]\nMXXXXXXAA\n"},
+		{name: "negative threshold", options: "-frame=1 -mask-lowcomplexity=-1", err: "wrong value for --mask-lowcomplexity parameter: -1"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := translateString(test.options, input)
+			if test.err != "" {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Errorf("expected error containing %s but got %v", test.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Error(err)
+			}
+			if want := test.expected; want != got {
+				t.Errorf("expected\n%s\nbut got\n%s\n", want, got)
+			}
+		})
+	}
+}
+
+func TestReplaceInternalStops(t *testing.T) {
+
+	// MA*K*F* in frame 1, with an incomplete codon in frame 1 of s2
+	input := ">s1\nATGGCCTAAAAATGATTTTAA\n>s2\nATGGCCTAAAAATGATTTTAAG\n"
+
+	tests := []struct {
+		name     string
+		options  string
+		expected string
+		err      string
+	}{
+		{name: "stops kept", options: "-frame=1", expected: ">s1_1\nMA*K*F*\n>s2_1\nMA*K*F*X\n"},
+		{name: "internal stops replaced", options: "-frame=1 -replace-internal-stops=X", expected: ">s1_1\nMAXKXF*\n>s2_1\nMAXKXF*X\n"},
+		{name: "other char", options: "-frame=1 -replace-internal-stops=U -stopchar=.", expected: ">s1_1\nMAUKUF.\n>s2_1\nMAUKUF.X\n"},
+		{name: "with trim", options: "-frame=1 -replace-internal-stops=X -trim", expected: ">s1_1\nMAXKXF\n>s2_1\nMAXKXF\n"},
+		{name: "with clean", options: "-frame=1 -replace-internal-stops=Z -clean", expected: ">s1_1\nMAZKZFX\n>s2_1\nMAZKZFXX\n"},
+		{name: "several chars", options: "-frame=1 -replace-internal-stops=XX", err: "wrong value for --replace-internal-stops parameter: XX, must be a single character"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := translateString(test.options, input)
+			if test.err != "" {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Errorf("expected error containing %s but got %v", test.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Error(err)
+			}
+			if want := test.expected; want != got {
+				t.Errorf("expected\n%s\nbut got\n%s\n", want, got)
+			}
+		})
+	}
+}
+
+func TestPreserveCase(t *testing.T) {
+
+	// a soft-masked run of 3 codons, and a codon with mixed case
+	input := ">s1\natgGCCaaatttccctaagg\n"
+
+	tests := []struct {
+		name     string
+		options  string
+		expected string
+	}{
+		{name: "lowercase input", options: "-frame=1", expected: ">s1_1\nMAKFP*G\n"},
+		{name: "soft-masked codons", options: "-frame=1 -preserve-case", expected: ">s1_1\nmAkfp*G\n"},
+		{name: "reverse frame", options: "-frame=-1 -preserve-case", expected: ">s1_4\nlgkfGh\n"},
+		{name: "orf", options: "-frame=1 -orf=1 -preserve-case", expected: ">s1_1_1 [1 - 18]\nmAkfp\n"},
+		{name: "circular", options: "-frame=1 -circular -preserve-case", expected: ">s1_1\nmAkfp*g\n"},
+		{name: "three-letter", options: "-frame=1 -three-letter -preserve-case", expected: ">s1_1\nmet Ala lys phe pro Stop Gly\n"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := translateString(test.options, input)
+			if err != nil {
+				t.Error(err)
+			}
+			if want := test.expected; want != got {
+				t.Errorf("expected\n%s\nbut got\n%s\n", want, got)
+			}
+		})
+	}
+}
+
+func TestGap(t *testing.T) {
+
+	tests := []struct {
+		name     string
+		sequence string
+		expected string
+	}{
+		{name: "gap codon", sequence: "---", expected: "-"},
+		{name: "isolated gap", sequence: "A-G", expected: "X"},
+		{name: "two gaps", sequence: "A--", expected: "X"},
+		{name: "aligned sequence", sequence: "ATG---AAA-TTTAA", expected: "M-KX*"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := translateString("-frame=1", ">s1\n"+test.sequence+"\n")
+			if err != nil {
+				t.Error(err)
+			}
+			if want := ">s1_1\n" + test.expected + "\n"; got != want {
+				t.Errorf("expected\n%s\nbut got\n%s\n", want, got)
+			}
+		})
+	}
+}
+
+func TestStripN(t *testing.T) {
+
+	input := ">s1\nNNNATGNN\nNGCCTAANN\n>s2\nNNNN\n"
+
+	tests := []struct {
+		name     string
+		options  string
+		expected string
+	}{
+		{
+			name:     "without strip",
+			options:  "-frame=1,-1",
+			expected: ">s1_1\nXMXA*X\n>s1_4\nLGXHX\n>s2_1\nXX\n>s2_4\nX\n",
+		},
+		{
+			name:     "frames start at the first known nucleotide",
+			options:  "-frame=1,-1 -strip-n",
+			expected: ">s1_1\nMXA*\n>s1_4\nLGXH\n>s2_1\n>s2_4\n",
+		},
+		{
+			name:     "frame 2",
+			options:  "-frame=2 -strip-n",
+			expected: ">s1_2\nXXPX\n>s2_2\n",
+		},
+		{
+			name:     "orf positions",
+			options:  "-frame=1 -orf=1 -strip-n",
+			expected: ">s1_1_1 [1 - 12]\nMXA\n",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := translateString(test.options, input)
+			if err != nil {
+				t.Error(err)
+			}
+			if want := test.expected; want != got {
+				compareByline(t, want, got)
+			}
+		})
+	}
+}
+
+func TestCircular(t *testing.T) {
+
+	// frames 1, 5 and 6 have a codon spanning the end and the start
+	// of the sequence: ATG, CAT and CCA
+	want := map[string]string{
+		"p1_1": "GKM\n",
+		"p1_2": "EKW\n",
+		"p1_3": "KN\n",
+		"p1_4": "FS\n",
+		"p1_5": "FFH\n",
+		"p1_6": "IFP\n",
+	}
+
+	got, err := translateString("-frame=6 -circular", ">p1\nGGAAAAAT\n")
+	if err != nil {
+		t.Error(err)
+	}
+	records := parseRecords(got)
+	if len(records) != len(want) {
+		t.Errorf("expected %d records but got %d", len(want), len(records))
+	}
+	for id, prot := range want {
+		if records[id] != prot {
+			t.Errorf("%s: expected %q but got %q", id, prot, records[id])
+		}
+	}
+}
+
+func TestProgress(t *testing.T) {
+
+	input := randomFasta(100, 1)
+
+	options := transeq.Options{
+		Optional: transeq.Optional{
+			Frame:     "6",
+			NumWorker: 3,
+		},
+		Progress: &transeq.Progress{},
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		err := transeq.Translate(bytes.NewReader(input), ioutil.Discard, options)
+		if err != nil {
+			t.Error(err)
+		}
+	}()
+	// progress is read during the translation
+	for {
+		select {
+		case <-done:
+			if got := options.Progress.Sequences(); got != 100 {
+				t.Errorf("expected 100 sequences but got %d", got)
+			}
+			if got := options.Progress.BytesRead(); got != int64(len(input)) {
+				t.Errorf("expected %d bytes read but got %d", len(input), got)
+			}
+			return
+		default:
+			options.Progress.Sequences()
+			options.Progress.BytesRead()
+		}
+	}
+}
+
+func TestEmptyInput(t *testing.T) {
+
+	tests := []struct {
+		name  string
+		input string
+	}{
+		{name: "empty", input: ""},
+		{name: "blank lines", input: "\n\n\r\n"},
+		{name: "whitespace only", input: "  \n\t\n \t \r\n"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := translateString("-frame=6", test.input)
+			if err != nil {
+				t.Error(err)
+			}
+			if got != "" {
+				t.Errorf("expected an empty output but got\n%s", got)
+			}
+		})
+	}
+}
+
+func TestEmptyID(t *testing.T) {
+
+	for _, input := range []string{">\nATG\n", ">s1\nATG\n>\nATG\n", ">s1\nATG\n\n> comment\nATG\n"} {
+		_, err := translateString("-frame=1", input)
+		if err == nil {
+			t.Errorf("expected an error for input %q", input)
+			continue
+		}
+		lineNumber := strings.Count(input[:strings.LastIndex(input, ">")], "\n") + 1
+		if want := fmt.Sprintf("line %d: sequence has no id", lineNumber); !strings.Contains(err.Error(), want) {
+			t.Errorf("expected error '%s' but got '%v'", want, err)
+		}
+	}
+}
+
+func TestProteinInput(t *testing.T) {
+
+	protein := ">sp|P1 a protein\nMKTAYIAKQRQISFVKSHFSRQLEERLGLIEVQAPILSRVGDGTQDNLSGAEKAVQVKVKALPDAQ\n"
+
+	tests := []struct {
+		name  string
+		force bool
+		input string
+		err   string
+	}{
+		{name: "protein", input: protein, err: "line 2: input appears to be protein, not nucleotide (sequence sp|P1), use --force-nucleotide to translate it anyway"},
+		{name: "lowercase protein", input: strings.ToLower(protein), err: "input appears to be protein"},
+		{name: "forced", force: true, input: protein},
+		// IUPAC codes and a few invalid chars are not AA
+		{name: "ambiguous nucleotides", input: ">s1\nATGRYSWKMBDHVNACGTACGTAACGTTGCAE\n"},
+		// only the first sequence is checked
+		{name: "second sequence", input: ">s1\nATG\n" + protein},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			options := transeq.Options{
+				Optional: transeq.Optional{
+					Frame:           "1",
+					NumWorker:       1,
+					ForceNucleotide: test.force,
+				},
+				Warnings: ioutil.Discard,
+			}
+			err := transeq.TranslateStream(strings.NewReader(test.input), ioutil.Discard, options)
+			if test.err == "" {
+				if err != nil {
+					t.Error(err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("expected error containing %s but got %v", test.err, err)
+			}
+		})
+	}
+}
+
+func TestInvalidCharWarning(t *testing.T) {
+
+	input, err := ioutil.ReadFile("testdata/invalid_char.fna")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var warnings bytes.Buffer
+	options := transeq.Options{
+		Optional: transeq.Optional{
+			Frame:     "1",
+			NumWorker: 1,
+		},
+		Warnings: &warnings,
+	}
+	err = transeq.Translate(bytes.NewReader(input), ioutil.Discard, options)
+	if err != nil {
+		t.Error(err)
+	}
+	want := "WARNING: line 6: invalid char in sequence seq2: J, ignoring\n"
+	if warnings.String() != want {
+		t.Errorf("expected warning\n%s\nbut got\n%s", want, warnings.String())
+	}
+}
+
+const tsvHeader = "id\tframe\tlength\tprotein\n"
+
+func TestTSV(t *testing.T) {
+
+	input := ">other1 from second file\nATGGCGTAA\n>other2\nTTTCCC\n"
+
+	tests := []struct {
+		opts     string
+		expected string
+	}{
+		{
+			opts:     "-frame=1 -format=tsv",
+			expected: "other1\t1\t3\tMA*\nother2\t1\t2\tFP\n",
+		},
+		{
+			opts:     "-frame=1 -format=tsv -tsv-header",
+			expected: tsvHeader + "other1\t1\t3\tMA*\nother2\t1\t2\tFP\n",
+		},
+		{
+			opts:     "-frame=1 -format=tsv -trim",
+			expected: "other1\t1\t2\tMA\nother2\t1\t2\tFP\n",
+		},
+		{
+			opts:     "-frame=1 -format=tsv -three-letter",
+			expected: "other1\t1\t3\tMet Ala Stop\nother2\t1\t2\tPhe Pro\n",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.opts, func(t *testing.T) {
+			got, err := translateString(test.opts, input)
+			if err != nil {
+				t.Error(err)
+			}
+			if got != test.expected {
+				t.Errorf("expected\n%s\nbut got\n%s\n", test.expected, got)
+			}
+		})
+	}
+
+	// lines are not wrapped
+	got, err := translateString("-frame=1 -format=tsv", ">s1\n"+strings.Repeat("ATG", 100)+"\n")
+	if err != nil {
+		t.Error(err)
+	}
+	if want := "s1\t1\t100\t" + strings.Repeat("M", 100) + "\n"; got != want {
+		t.Errorf("expected\n%s\nbut got\n%s\n", want, got)
+	}
+
+	// with a writer per frame, only write the header to the translated frames
+	outs := make([]io.Writer, 6)
+	var frame1 bytes.Buffer
+	outs[0] = &frame1
+	options, err := getOptionsAndName("-frame=1 -format=tsv -tsv-header")
+	if err != nil {
+		t.Fatal(err)
+	}
+	options.NumWorker = 1
+	_, err = transeq.TranslateFilesSplit([]string{"testdata/test2.fna"}, outs, options)
+	if err != nil {
+		t.Error(err)
+	}
+	if want := tsvHeader + "other1\t1\t3\tMA*\nother2\t1\t2\tFP\n"; frame1.String() != want {
+		t.Errorf("expected\n%s\nbut got\n%s\n", want, frame1.String())
+	}
+
+	_, err = translateString("-format=tsv -orf=10", input)
+	if err == nil {
+		t.Error("expected an error for --orf with the tsv format")
+	}
+}
+
+func TestJSONLines(t *testing.T) {
+
+	type jsonRecord struct {
+		ID      string
+		Frame   int
+		Comment string
+		Protein string
+		ORF     int
+		Begin   int
+		End     int
+	}
+
+	tests := []struct {
+		opts     string
+		input    string
+		expected []jsonRecord
+	}{
+		{
+			opts:  "-frame=F -format=jsonl",
+			input: ">other1 from second file\nATGGCGTAA\n>other2\nTTTCCC\n",
+			expected: []jsonRecord{
+				{ID: "other1", Frame: 1, Comment: "from second file", Protein: "MA*"},
+				{ID: "other1", Frame: 2, Comment: "from second file", Protein: "WRX"},
+				{ID: "other1", Frame: 3, Comment: "from second file", Protein: "GVX"},
+				{ID: "other2", Frame: 1, Protein: "FP"},
+				{ID: "other2", Frame: 2, Protein: "FP"},
+				{ID: "other2", Frame: 3, Protein: "SX"},
+			},
+		},
+		{
+			opts:  "-frame=6 -format=jsonl -orf=1",
+			input: ">s1 c\nCCATGAAATTTTAGCCATGCCCTAA\n",
+			expected: []jsonRecord{
+				{ID: "s1", Frame: 2, Comment: "c", Protein: "MP", ORF: 1, Begin: 17, End: 25},
+				{ID: "s1", Frame: 3, Comment: "c", Protein: "MKF", ORF: 1, Begin: 3, End: 14},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.opts, func(t *testing.T) {
+
+			got, err := translateString(test.opts, test.input)
+			if err != nil {
+				t.Error(err)
+			}
+
+			decoder := json.NewDecoder(strings.NewReader(got))
+			for _, want := range test.expected {
+				var record jsonRecord
+				if err := decoder.Decode(&record); err != nil {
+					t.Fatalf("fail to decode record %v: %v", want, err)
+				}
+				if record != want {
+					t.Errorf("expected %+v but got %+v", want, record)
+				}
+			}
+			if decoder.More() {
+				t.Errorf("unexpected records in output:\n%s", got)
+			}
+		})
+	}
+}
+
+func TestGroupByFrame(t *testing.T) {
+
+	input := ">other1 from second file\nATGGCGTAA\n>other2\nTTTCCC\n"
+
+	expected := ">other1_1 from second file\nMA*\n>other2_1\nFP\n" +
+		">other1_2 from second file\nWRX\n>other2_2\nFP\n" +
+		">other1_3 from second file\nGVX\n>other2_3\nSX\n" +
+		">other1_4 from second file\nLRH\n>other2_4\nGK\n" +
+		">other1_5 from second file\nTPX\n>other2_5\nEX\n" +
+		">other1_6 from second file\nYAX\n>other2_6\nGX\n"
+
+	got, err := translateString("-frame=6 -group-by-frame", input)
+	if err != nil {
+		t.Error(err)
+	}
+	if got != expected {
+		t.Errorf("expected\n%s\nbut got\n%s\n", expected, got)
+	}
+
+	got, err = translateString("-frame=F -group-by-frame -format=tsv -tsv-header", input)
+	if err != nil {
+		t.Error(err)
+	}
+	expected = tsvHeader + "other1\t1\t3\tMA*\nother2\t1\t2\tFP\n" +
+		"other1\t2\t3\tWRX\nother2\t2\t2\tFP\n" +
+		"other1\t3\t3\tGVX\nother2\t3\t2\tSX\n"
+	if got != expected {
+		t.Errorf("expected\n%s\nbut got\n%s\n", expected, got)
+	}
+}
+
+func TestConcatFrames(t *testing.T) {
+
+	input := ">s1 first sequence\nATGGCCAAATTTCCCTAAGG\n>s2\nATG\n"
+
+	tests := []struct {
+		name     string
+		options  string
+		expected string
+		err      string
+	}{
+		{name: "six frames", options: "-frame=6 -concat-frames", expected: ">s1 frames=1:1-7,2:9-15,3:17-22,4:24-29,5:31-37,6:39-45 first sequence\nMAKFP*G*WPNFPKX*GQISLR*LGKFGH*LREIWPX*P*GNLAX\n>s2 frames=1:1-1,2:3-3,3:5-5,4:7-7,5:9-9,6:11-11\nM*X*X*H*X*X\n"},
+		{name: "frame order", options: "-frame=-1,1 -concat-frames", expected: ">s1 frames=1:1-7,4:9-14 first sequence\nMAKFP*G*LGKFGH\n>s2 frames=1:1-1,4:3-3\nM*H\n"},
+		{name: "stop char", options: "-frame=1,2 -concat-frames -stopchar=.", expected: ">s1 frames=1:1-7,2:9-15 first sequence\nMAKFP.G.WPNFPKX\n>s2 frames=1:1-1,2:3-3\nM.X\n"},
+		{name: "terminal unknown", options: "-frame=6 -concat-frames -terminal-unknown=-", expected: ">s1 frames=1:1-7,2:9-15,3:17-22,4:24-29,5:31-37,6:39-45 first sequence\nMAKFP*G*WPNFPK-*GQISLR*LGKFGH*LREIWP-*P*GNLA-\n>s2 frames=1:1-1,2:3-3,3:5-5,4:7-7,5:9-9,6:11-11\nM*-*-*H*-*-\n"},
+		{name: "frames too short", options: "-frame=1,2 -concat-frames -min-protein-len=2", expected: ">s1 frames=1:1-7,2:9-15 first sequence\nMAKFP*G*WPNFPKX\n"},
+		{name: "orf", options: "-frame=6 -concat-frames -orf=1", err: "--concat-frames can only be used with the fasta format, without --orf"},
+		{name: "tsv", options: "-frame=6 -concat-frames -format=tsv", err: "--concat-frames can only be used with the fasta format, without --orf"},
+		{name: "group by frame", options: "-frame=6 -concat-frames -group-by-frame", err: "--concat-frames can't be used with --group-by-frame"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := translateString(test.options, input)
+			if test.err != "" {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Errorf("expected error containing %s but got %v", test.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Error(err)
+			}
+			if want := test.expected; want != got {
+				t.Errorf("expected\n%s\nbut got\n%s\n", want, got)
+			}
+		})
+	}
+
+	// all frames have to be written to the same writer
+	outs := make([]io.Writer, 6)
+	for i := range outs {
+		outs[i] = &bytes.Buffer{}
+	}
+	options := transeq.Options{Optional: transeq.Optional{Frame: "6", NumWorker: 1, ConcatFrames: true}}
+	_, err := transeq.TranslateFilesSplit([]string{"testdata/test2.fna"}, outs, options)
+	if want := "--concat-frames needs the same output writer for all frames"; err == nil || err.Error() != want {
+		t.Errorf("expected error '%s' but got %v", want, err)
+	}
+}
+
+func TestSortByLength(t *testing.T) {
+
+	input := ">a\nATGGC\n>b long\nATGGCCAAATTT\n>c\nATG\n>d\nTTTCCC\n"
+
+	got, err := translateString("-frame=1 -sort-by-length", input)
+	if err != nil {
+		t.Error(err)
+	}
+	// a and d have the same length, they are in the input order
+	if want := ">b_1 long\nMAKF\n>a_1\nMA\n>d_1\nFP\n>c_1\nM\n"; got != want {
+		t.Errorf("expected\n%s\nbut got\n%s\n", want, got)
+	}
+
+	got, err = translateString("-frame=1,-1 -sort-by-length -format=tsv -tsv-header", input)
+	if err != nil {
+		t.Error(err)
+	}
+	want := tsvHeader + "b\t1\t4\tMAKF\nb\t4\t4\tKFGH\na\t1\t2\tMA\nd\t1\t2\tFP\nd\t4\t2\tGK\na\t4\t1\tH\nc\t1\t1\tM\nc\t4\t1\tH\n"
+	if got != want {
+		compareByline(t, want, got)
+	}
+
+	// the order doesn't depend on the nb of threads
+	fasta := randomFasta(100, 1)
+	var outputs [2]bytes.Buffer
+	for i, numWorker := range []int{1, 4} {
+		options := transeq.Options{Optional: transeq.Optional{Frame: "6", SortByLength: true, NumWorker: numWorker}}
+		if err := transeq.Translate(bytes.NewReader(fasta), &outputs[i], options); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if outputs[0].String() != outputs[1].String() {
+		t.Error("expected the same output with 1 and 4 threads")
+	}
+}
+
+func TestQueueDepth(t *testing.T) {
+
+	want, err := translateString("-frame=6", string(randomFasta(50, 1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, depth := range []string{"1", "3", "100"} {
+		got, err := translateString("-frame=6 -queue-depth="+depth, string(randomFasta(50, 1)))
+		if err != nil {
+			t.Error(err)
+		}
+		if got != want {
+			t.Errorf("queue depth %s: translation differs from the default one", depth)
+		}
+	}
+
+	_, err = translateString("-queue-depth=-1", ">s1\nATG\n")
+	if err == nil {
+		t.Error("expected an error for a negative queue depth")
+	}
+}
+
+func TestTranslateStream(t *testing.T) {
+
+	options := transeq.Options{
+		Optional: transeq.Optional{
+			Frame:     "1",
+			NumWorker: 2,
+		},
+	}
+
+	var out bytes.Buffer
+	err := transeq.TranslateStream(strings.NewReader(">other1 from second file\nATGGCGTAA\n>other2\nTTTCCC\n"), &out, options)
+	if err != nil {
+		t.Error(err)
+	}
+	if want := ">other1_1 from second file\nMA*\n>other2_1\nFP\n"; out.String() != want {
+		t.Errorf("expected\n%s\nbut got\n%s\n", want, out.String())
+	}
+}
+
+func TestWarnAmbiguous(t *testing.T) {
+
+	// frame 1 of s1 has codons NCC and NNN, the final incomplete
+	// codon AN is not counted. CCN is translated to P
+	input := ">s1\nATGNCCAAANNNTTTCCNAN\n>s2\nATGCCC\n"
+
+	var warnings bytes.Buffer
+	options := transeq.Options{
+		Optional: transeq.Optional{
+			Frame:         "1",
+			NumWorker:     1,
+			WarnAmbiguous: true,
+		},
+		Warnings: &warnings,
+	}
+	var out bytes.Buffer
+	err := transeq.Translate(strings.NewReader(input), &out, options)
+	if err != nil {
+		t.Error(err)
+	}
+	if want := ">s1_1\nMXKXFPX\n>s2_1\nMP\n"; out.String() != want {
+		t.Errorf("expected\n%s\nbut got\n%s\n", want, out.String())
+	}
+	if want := "WARNING: sequence s1: 2 codons with unknown nucleotides translated to X\n"; warnings.String() != want {
+		t.Errorf("expected warnings\n%s\nbut got\n%s", want, warnings.String())
+	}
+}
+
+func TestUnknownCodons(t *testing.T) {
+
+	// frame 1 of s1 has codons NCC and NRA with a 'N', and ART with an
+	// ambiguity code. The incomplete codons G and TA of s3 and s4 can't
+	// be guessed, unlike GC of s2 translated to A. The codons GCR, GCN and
+	// GCY of s5 are always A, but ATR may be I or M
+	var warnings bytes.Buffer
+	options := transeq.Options{
+		Optional: transeq.Optional{
+			Frame:     "1",
+			NumWorker: 2,
+		},
+		Warnings: &warnings,
+	}
+	var out bytes.Buffer
+	summary, err := transeq.TranslateFiles([]string{"testdata/test_unknown.fna"}, &out, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := ">s1_1\nMXXX\n>s2_1\nMA\n>s3_1\nMX\n>s4_1\nMX\n>s5_1\nAAAX\n"; out.String() != want {
+		t.Errorf("expected\n%s\nbut got\n%s\n", want, out.String())
+	}
+	if summary.UnknownCodons != 2 || summary.AmbiguousCodons != 2 || summary.IncompleteCodons != 2 {
+		t.Errorf("expected 2 codons with a N, 2 with an ambiguity code and 2 incomplete, but got %+v", summary)
+	}
+	// ambiguity codes are valid nucleotides
+	if warnings.Len() > 0 {
+		t.Errorf("expected no warning but got\n%s", warnings.String())
+	}
+}
+
+func TestHeaderComment(t *testing.T) {
+
+	tests := []struct {
+		name     string
+		header   string
+		expected string
+	}{
+		{name: "tab in comment", header: ">s1 gene=abc\tlen=9\t", expected: ">s1_1 gene=abc\tlen=9\t"},
+		{name: "tab after id", header: ">s1\tgene=abc\tlen=9", expected: ">s1_1 gene=abc\tlen=9"},
+		{name: "several spaces after id", header: ">s1   gene abc", expected: ">s1_1 gene abc"},
+		{name: "no comment", header: ">s1|ref|NC_001", expected: ">s1|ref|NC_001_1"},
+		{name: "blank comment", header: ">s1 \t ", expected: ">s1_1"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := translateString("-frame=1", test.header+"\nATG\n")
+			if err != nil {
+				t.Error(err)
+			}
+			if want := test.expected + "\nM\n"; got != want {
+				t.Errorf("expected %q but got %q", want, got)
+			}
+		})
+	}
+}
+
+func TestAnnotateLength(t *testing.T) {
+
+	input := ">s1 first\nATGGCC\nAAATTT\n>s2\nATG\n"
+
+	tests := []struct {
+		name     string
+		options  string
+		expected string
+	}{
+		{
+			name:     "fasta",
+			options:  "-frame=1 -annotate-length",
+			expected: ">s1_1 first len=12\nMAKF\n>s2_1 len=3\nM\n",
+		},
+		{
+			name:     "emboss reverse frames",
+			options:  "-frame=-1 -annotate-length -header-style=emboss",
+			expected: ">s1_4 first len=12 (REVERSE SENSE)\nKFGH\n>s2_4 len=3 (REVERSE SENSE)\nH\n",
+		},
+		{
+			name:     "region",
+			options:  "-frame=1 -annotate-length -region=1-6",
+			expected: ">s1_1 first len=6\nMA\n>s2_1 len=3\nM\n",
+		},
+		{
+			name:     "without comment",
+			options:  "-frame=1 -annotate-length -no-comment",
+			expected: ">s1_1 len=12\nMAKF\n>s2_1 len=3\nM\n",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := translateString(test.options, input)
+			if err != nil {
+				t.Error(err)
+			}
+			if want := test.expected; want != got {
+				compareByline(t, want, got)
+			}
+		})
+	}
+}
+
+func TestNoComment(t *testing.T) {
+
+	input := ">s1 first sequence\nATG\n>s2\tsecond\tsequence\nATG\n>s3\nATG\n"
+
+	tests := []struct {
+		name     string
+		options  string
+		expected string
+	}{
+		{
+			name:     "fasta",
+			options:  "-frame=1 -no-comment",
+			expected: ">s1_1\nM\n>s2_1\nM\n>s3_1\nM\n",
+		},
+		{
+			name:     "emboss headers",
+			options:  "-frame=-1 -no-comment -header-style=emboss",
+			expected: ">s1_4 (REVERSE SENSE)\nH\n>s2_4 (REVERSE SENSE)\nH\n>s3_4 (REVERSE SENSE)\nH\n",
+		},
+		{
+			name:     "jsonl",
+			options:  "-frame=1 -no-comment -format=jsonl",
+			expected: `{"id":"s1","frame":1,"comment":"","protein":"M"}` + "\n" + `{"id":"s2","frame":1,"comment":"","protein":"M"}` + "\n" + `{"id":"s3","frame":1,"comment":"","protein":"M"}` + "\n",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := translateString(test.options, input)
+			if err != nil {
+				t.Error(err)
+			}
+			if got != test.expected {
+				t.Errorf("expected %q but got %q", test.expected, got)
+			}
+		})
+	}
+
+	// the frame tag is still read
+	got, err := translateString("-frame=1 -no-comment -frame-from-header", ">s1 some frame=2\nATGCCC\n")
+	if err != nil {
+		t.Error(err)
+	}
+	if want := ">s1_2\nCP\n"; got != want {
+		t.Errorf("expected %q but got %q", want, got)
+	}
+}
+
+func TestNoFinalNewline(t *testing.T) {
+
+	input, err := ioutil.ReadFile("testdata/no_final_newline.fna")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if input[len(input)-1] == '\n' {
+		t.Fatal("testdata/no_final_newline.fna should not end with a newline")
+	}
+
+	want, err := translateString("-frame=6", string(input)+"\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := translateString("-frame=6", string(input))
+	if err != nil {
+		t.Error(err)
+	}
+	if got != want {
+		t.Errorf("expected\n%s\nbut got\n%s\n", want, got)
+	}
+	if !strings.Contains(got, ">other2_1\nFPG\n") {
+		t.Errorf("last line of the last sequence is missing:\n%s", got)
+	}
+
+	// a last sequence with only a header
+	got, err = translateString("-frame=1", ">s1\nATG\n>s2")
+	if err != nil {
+		t.Error(err)
+	}
+	if want := ">s1_1\nM\n>s2_1\n"; got != want {
+		t.Errorf("expected\n%s\nbut got\n%s\n", want, got)
+	}
+}
+
+func TestGolden(t *testing.T) {
+
+	input, err := ioutil.ReadFile("testdata/test.fna")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		golden string
+		opts   string
+	}{
+		{golden: "frame6.faa", opts: "-frame=6"},
+		{golden: "frame6_trim.faa", opts: "-frame=6 -trim"},
+		{golden: "frame6_clean.faa", opts: "-frame=6 -clean"},
+		{golden: "frame6_alternative.faa", opts: "-frame=6 -alternative"},
+		{golden: "frame6_circular.faa", opts: "-frame=6 -circular"},
+		{golden: "frame6_emboss.faa", opts: "-frame=6 -header-style=emboss"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.golden, func(t *testing.T) {
+
+			want, err := ioutil.ReadFile("testdata/golden/" + test.golden)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := translateString(test.opts, string(input))
+			if err != nil {
+				t.Error(err)
+			}
+			if got != string(want) {
+				compareByline(t, string(want), got)
+			}
+		})
+	}
+}
+
+func TestMaxMemory(t *testing.T) {
+
+	input := string(randomFasta(200, 1))
+	want, err := translateString("-frame=6", input)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		options string
+		err     string
+	}{
+		{name: "large limit", options: "-frame=6 -max-memory=2GB"},
+		{name: "limit in bytes", options: "-frame=6 -max-memory=1073741824"},
+		{name: "lowercase unit", options: "-frame=6 -max-memory=512mb"},
+		{name: "tiny limit", options: "-frame=6 -max-memory=1KB", err: "more than 1KB of buffered data"},
+		{name: "zero", options: "-frame=6 -max-memory=0", err: "wrong value for --max-memory parameter: 0, must be a size like '2GB' or '512MB'"},
+		{name: "unknown unit", options: "-frame=6 -max-memory=2PB", err: "wrong value for --max-memory parameter: 2PB"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := translateString(test.options, input)
+			if test.err != "" {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Errorf("expected error containing %s but got %v", test.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Error(err)
+			}
+			if got != want {
+				t.Error("translation with a memory limit differs from the translation without limit")
+			}
+		})
+	}
+}
+
+// a writer failing on each write, counting the nb of writes
+type failingWriter struct {
+	name   string
+	writes *int64
+}
+
+func (w failingWriter) Write(p []byte) (int, error) {
+	atomic.AddInt64(w.writes, 1)
+	return 0, fmt.Errorf("%s is full", w.name)
+}
+
+func TestWriteErrors(t *testing.T) {
+
+	options := transeq.Options{
+		Optional: transeq.Optional{
+			Frame:      "6",
+			NumWorker:  4,
+			FlushBytes: 1,
+		},
+	}
+	inputs := []string{"testdata/test.fna", "testdata/test.fna.gz", "testdata/test2.fna"}
+	goroutines := runtime.NumGoroutine()
+
+	for i := 0; i < 20; i++ {
+		var writes int64
+		outs := make([]io.Writer, 6)
+		for frame := range outs {
+			outs[frame] = failingWriter{name: fmt.Sprintf("output %d", frame+1), writes: &writes}
+		}
+		_, err := transeq.TranslateFilesSplit(inputs, outs, options)
+		// writers are flushed in the order of the frames
+		if want := "fail to write to output file: output 1 is full"; err == nil || err.Error() != want {
+			t.Fatalf("expected error '%s' but got %v", want, err)
+		}
+		if writes != 1 {
+			t.Errorf("expected a single write but got %d", writes)
+		}
+	}
+
+	// all readers, workers and writers are stopped
+	for i := 0; i < 100 && runtime.NumGoroutine() > goroutines; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n := runtime.NumGoroutine(); n > goroutines {
+		t.Errorf("expected %d goroutines after the errors but got %d", goroutines, n)
+	}
+}
+
+// a writer cancelling a context on its third write, like a SIGINT
+// received during the translation
+type interruptingWriter struct {
+	bytes.Buffer
+	writes int
+	cancel context.CancelFunc
+}
+
+func (w *interruptingWriter) Write(p []byte) (int, error) {
+	w.writes++
+	if w.writes == 3 {
+		w.cancel()
+	}
+	return w.Buffer.Write(p)
+}
+
+// a reader cancelling a context once half of its content is read,
+// like a SIGINT received while reading the input
+type interruptingReader struct {
+	r      *bytes.Reader
+	cancel context.CancelFunc
+}
+
+func (r *interruptingReader) Read(p []byte) (int, error) {
+	if r.r.Len() < int(r.r.Size())/2 {
+		r.cancel()
+	}
+	if len(p) > 4096 {
+		p = p[:4096]
+	}
+	return r.r.Read(p)
+}
+
+func TestInterrupt(t *testing.T) {
+
+	input := randomFasta(500, 1)
+	goroutines := runtime.NumGoroutine()
+
+	for i := 0; i < 20; i++ {
+		ctx, cancel := context.WithCancel(context.Background())
+		out := &interruptingWriter{cancel: cancel}
+		options := transeq.Options{
+			Optional: transeq.Optional{
+				Frame:      "6",
+				NumWorker:  4,
+				FlushBytes: 1,
+			},
+			Context: ctx,
+		}
+		err := transeq.TranslateStream(bytes.NewReader(input), out, options)
+		cancel()
+		if err != transeq.ErrInterrupted {
+			t.Fatalf("expected error '%v' but got %v", transeq.ErrInterrupted, err)
+		}
+
+		// the output holds all frames of the first sequences, in order
+		got := out.String()
+		if !strings.HasSuffix(got, "\n") {
+			t.Fatalf("expected the output to end with a complete record but got\n%s", got[len(got)-100:])
+		}
+		var headers []string
+		for _, line := range strings.Split(got, "\n") {
+			if strings.HasPrefix(line, ">") {
+				headers = append(headers, line)
+			}
+		}
+		if len(headers) == 0 || len(headers)%6 != 0 || len(headers) == 6*500 {
+			t.Fatalf("expected the frames of some of the sequences but got %d frames", len(headers))
+		}
+		for n, header := range headers {
+			if want := fmt.Sprintf(">seq%d_%d random sequence", n/6, n%6+1); header != want {
+				t.Fatalf("expected header %s but got %s", want, header)
+			}
+		}
+	}
+
+	// the records kept in memory are written when interrupted
+	for _, option := range []string{"sort-by-length", "group-by-frame"} {
+		ctx, cancel := context.WithCancel(context.Background())
+		options := transeq.Options{
+			Optional: transeq.Optional{
+				Frame:        "6",
+				NumWorker:    4,
+				SortByLength: option == "sort-by-length",
+				GroupByFrame: option == "group-by-frame",
+			},
+			Context: ctx,
+		}
+		var out bytes.Buffer
+		err := transeq.TranslateStream(&interruptingReader{r: bytes.NewReader(input), cancel: cancel}, &out, options)
+		cancel()
+		if err != transeq.ErrInterrupted {
+			t.Fatalf("%s: expected error '%v' but got %v", option, transeq.ErrInterrupted, err)
+		}
+
+		// all frames of each translated sequence are written
+		frames := map[string]int{}
+		lastFrame := 0
+		for _, line := range strings.Split(out.String(), "\n") {
+			if !strings.HasPrefix(line, ">") {
+				continue
+			}
+			id := strings.TrimSuffix(line, " random sequence")
+			frame, err := strconv.Atoi(id[strings.LastIndexByte(id, '_')+1:])
+			if err != nil {
+				t.Fatal(err)
+			}
+			if option == "group-by-frame" && frame < lastFrame {
+				t.Errorf("%s: expected the records grouped by frame but got %s after frame %d", option, line, lastFrame)
+			}
+			lastFrame = frame
+			frames[id[:strings.LastIndexByte(id, '_')]]++
+		}
+		if len(frames) == 0 || len(frames) == 500 {
+			t.Errorf("%s: expected some of the sequences but got %d sequences", option, len(frames))
+		}
+		for id, n := range frames {
+			if n != 6 {
+				t.Errorf("%s: expected 6 frames for %s but got %d", option, id, n)
+			}
+		}
+	}
+
+	// a context done before the translation
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	options := transeq.Options{Optional: transeq.Optional{Frame: "1", NumWorker: 4}, Context: ctx}
+	if _, err := transeq.TranslateFiles([]string{"testdata/test.fna"}, ioutil.Discard, options); err != transeq.ErrInterrupted {
+		t.Errorf("expected error '%v' but got %v", transeq.ErrInterrupted, err)
+	}
+
+	// all readers, workers and writers are stopped
+	for i := 0; i < 100 && runtime.NumGoroutine() > goroutines; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n := runtime.NumGoroutine(); n > goroutines {
+		t.Errorf("expected %d goroutines after the interruptions but got %d", goroutines, n)
+	}
+}
+
+func TestTimeout(t *testing.T) {
+
+	input := string(randomFasta(200, 1))
+
+	_, err := translateString("-frame=6 -timeout=1ns", input)
+	if err == nil || !strings.Contains(err.Error(), "timed out after 1ns") {
+		t.Errorf("expected a timeout error but got %v", err)
+	}
+
+	want, err := translateString("-frame=6", input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := translateString("-frame=6 -timeout=1m", input)
+	if err != nil {
+		t.Error(err)
+	}
+	if got != want {
+		t.Error("translation with a timeout differs from the translation without timeout")
+	}
+
+	_, err = translateString("-frame=6 -timeout=-1s", input)
+	if err == nil {
+		t.Error("expected an error for a negative timeout")
+	}
+}
+
+func translateString(opts string, input string) (string, error) {
+
+	options, err := getOptionsAndName(opts)
+	if err != nil {
+		return "", err
+	}
+	options.NumWorker = 1
+
+	out := bytes.NewBuffer(nil)
+	err = transeq.Translate(strings.NewReader(input), out, options)
+	return out.String(), err
+}
+
 func getOptionsAndName(opts string) (options transeq.Options, err error) {
 
 	// convert emboss transeq flag (single '-' prefix) to gotranseq flags
@@ -98,11 +3567,82 @@ func compareByline(t *testing.T, want, got string) {
 	t.Errorf("found differences in lines\n%v\n", diffs)
 }
 
+// generate a fasta file of nbSequences sequences with random nucleotides.
+// The same seed always generates the same file
+func randomFasta(nbSequences int, seed int64) []byte {
+
+	r := rand.New(rand.NewSource(seed))
+	nucleotides := "ACGT"
+
+	var fasta bytes.Buffer
+	for i := 0; i < nbSequences; i++ {
+		fmt.Fprintf(&fasta, ">seq%d random sequence\n", i)
+		length := 500 + r.Intn(4500)
+		for j := 1; j <= length; j++ {
+			fasta.WriteByte(nucleotides[r.Intn(len(nucleotides))])
+			if j%60 == 0 || j == length {
+				fasta.WriteByte('\n')
+			}
+		}
+	}
+	return fasta.Bytes()
+}
+
 func BenchmarkTranslate(b *testing.B) {
 
-	input, err := os.Open("testdata/big.fna")
-	if err != nil {
-		b.Error(err)
+	input := randomFasta(1000, 1)
+
+	options := transeq.Options{
+		Optional: transeq.Optional{
+			Frame:     "6",
+			NumWorker: 3,
+		},
+	}
+
+	b.SetBytes(int64(len(input)))
+	b.ResetTimer()
+
+	for n := 0; n < b.N; n++ {
+		err := transeq.Translate(bytes.NewReader(input), ioutil.Discard, options)
+		if err != nil {
+			b.Error(err)
+		}
+	}
+}
+
+func BenchmarkQueueDepth(b *testing.B) {
+
+	input := randomFasta(1000, 1)
+
+	for _, depth := range []int{1, 4, 16, 64} {
+		b.Run(strconv.Itoa(depth), func(b *testing.B) {
+
+			options := transeq.Options{
+				Optional: transeq.Optional{
+					Frame:      "6",
+					NumWorker:  3,
+					QueueDepth: depth,
+				},
+			}
+
+			b.SetBytes(int64(len(input)))
+			b.ResetTimer()
+
+			for n := 0; n < b.N; n++ {
+				err := transeq.Translate(bytes.NewReader(input), ioutil.Discard, options)
+				if err != nil {
+					b.Error(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkTranslateShortReads(b *testing.B) {
+
+	var input bytes.Buffer
+	for i := 0; i < 10000; i++ {
+		fmt.Fprintf(&input, ">read%d\nATGCGTACGTTAGCCATGACGTAGCTAGCTAGGCTAAGCTAGCATCGATCGATGCTAGCTAGCTAGC\n", i)
 	}
 
 	options := transeq.Options{
@@ -112,10 +3652,42 @@ func BenchmarkTranslate(b *testing.B) {
 		},
 	}
 
+	b.SetBytes(int64(input.Len()))
+	b.ReportAllocs()
 	b.ResetTimer()
 
 	for n := 0; n < b.N; n++ {
-		transeq.Translate(input, ioutil.Discard, options)
+		err := transeq.Translate(bytes.NewReader(input.Bytes()), ioutil.Discard, options)
+		if err != nil {
+			b.Error(err)
+		}
+	}
+}
+
+func BenchmarkTranslateLongSequence(b *testing.B) {
+
+	var input bytes.Buffer
+	input.WriteString(">chr1\n")
+	line := strings.Repeat("ACGT", 15) + "\n"
+	for i := 0; i < 200000; i++ {
+		input.WriteString(line)
+	}
+
+	options := transeq.Options{
+		Optional: transeq.Optional{
+			Frame:     "1",
+			NumWorker: 1,
+		},
 	}
 
+	b.SetBytes(int64(input.Len()))
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for n := 0; n < b.N; n++ {
+		err := transeq.Translate(bytes.NewReader(input.Bytes()), ioutil.Discard, options)
+		if err != nil {
+			b.Error(err)
+		}
+	}
 }